@@ -0,0 +1,61 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"vortex/service/bench"
+	"vortex/service/config"
+)
+
+var benchOptions = new(bench.Options)
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Produces synthetic status messages and optionally measures the time until they are written to the database",
+	Run: func(cmd *cobra.Command, args []string) {
+		config.LoadConfiguration()
+
+		if len(benchOptions.Topic) == 0 && len(config.Current.Kafka.Topics) > 0 {
+			benchOptions.Topic = config.Current.Kafka.Topics[0]
+		}
+		if benchOptions.Seed == 0 {
+			benchOptions.Seed = time.Now().UnixNano()
+		}
+
+		var ctx, cancel = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		var kafkaCfg, mongoCfg = config.Current.Kafka, config.Current.Mongo
+		var report, err = bench.Run(ctx, benchOptions, &kafkaCfg, &mongoCfg)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Could not run benchmark!")
+		}
+
+		fmt.Print(report.String())
+	},
+}
+
+func init() {
+	var flags = benchCmd.Flags()
+	flags.StringVar(&benchOptions.Topic, "topic", "", "the topic to produce to (defaults to the first configured topic)")
+	flags.IntVar(&benchOptions.Messages, "messages", 10000, "the amount of messages to produce")
+	flags.IntVar(&benchOptions.Rate, "rate", 1000, "the target rate in messages per second (0 is unlimited)")
+	flags.IntVar(&benchOptions.Keys, "keys", 1000, "the amount of distinct keys for the uniform and zipf distributions")
+	flags.StringVar(&benchOptions.Distribution, "distribution", bench.DistributionUnique, "the distribution of keys (unique, uniform or zipf)")
+	flags.Float64Var(&benchOptions.MetadataRatio, "metadata-ratio", 0.5, "the share of METADATA messages between 0 and 1")
+	flags.StringSliceVar(&benchOptions.Statuses, "statuses", bench.DefaultStatuses, "the statuses to pick from")
+	flags.Int64Var(&benchOptions.Seed, "seed", 0, "the seed of the random generator (0 picks a random seed)")
+	flags.BoolVar(&benchOptions.Measure, "measure", false, "polls the database until all documents appeared and reports their latency")
+	flags.DurationVar(&benchOptions.Timeout, "timeout", time.Minute, "the time to wait for documents after producing")
+	flags.DurationVar(&benchOptions.PollInterval, "poll-interval", 100*time.Millisecond, "the interval of looking up documents")
+}
@@ -0,0 +1,56 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"vortex/service/config"
+	"vortex/service/filter"
+	"vortex/service/mongo"
+)
+
+var mongoCmd = &cobra.Command{
+	Use:   "mongo",
+	Short: "Provides tools for managing the database",
+}
+
+var mongoIndexesCmd = &cobra.Command{
+	Use:   "indexes",
+	Short: "Shows the difference between the configured and the existing indexes without applying it",
+	Run: func(cmd *cobra.Command, args []string) {
+		config.LoadConfiguration()
+
+		var ctx = context.Background()
+		var mongoCfg = config.Current.Mongo
+		var client, err = mongo.Connect(ctx, &mongoCfg)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Could not connect to database!")
+		}
+		defer client.Disconnect(ctx)
+
+		messageFilter, err := filter.NewFilter(config.Current.Filters)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Could not compile filters!")
+		}
+
+		var desired = mongo.DesiredIndexes(&mongoCfg)
+		for _, name := range mongo.Collections(&mongoCfg, messageFilter) {
+			var collection = client.Database(mongoCfg.Database).Collection(name)
+			diff, err := mongo.NewIndexManager(collection, desired).Diff(ctx)
+			if err != nil {
+				log.Fatal().Err(err).Str("collection", name).Msg("Could not compare indexes!")
+			}
+
+			fmt.Printf("%s:\n%s", name, diff.String())
+		}
+	},
+}
+
+func init() {
+	mongoCmd.AddCommand(mongoIndexesCmd)
+}
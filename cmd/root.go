@@ -14,4 +14,6 @@ var rootCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(initCmd)
 	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(mongoCmd)
+	rootCmd.AddCommand(benchCmd)
 }
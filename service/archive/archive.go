@@ -0,0 +1,84 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package archive
+
+import (
+	"encoding/json"
+	"github.com/IBM/sarama"
+	"slices"
+	"time"
+)
+
+// Record is a single line of an NDJSON archive holding a document along with the coordinates of its message.
+type Record struct {
+	Topic     string            `json:"topic"`
+	Partition int32             `json:"partition"`
+	Offset    int64             `json:"offset"`
+	Timestamp time.Time         `json:"timestamp"`
+	Key       string            `json:"key,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Value     any               `json:"value"`
+}
+
+// NewRecord returns the record of the given message and document. If a header occurs multiple times, the last value wins.
+func NewRecord(message *sarama.ConsumerMessage, document map[string]any) *Record {
+	var record = &Record{
+		Topic:     message.Topic,
+		Partition: message.Partition,
+		Offset:    message.Offset,
+		Timestamp: message.Timestamp,
+		Key:       string(message.Key),
+		Value:     document,
+	}
+
+	if len(message.Headers) > 0 {
+		record.Headers = make(map[string]string, len(message.Headers))
+		for _, header := range message.Headers {
+			record.Headers[string(header.Key)] = string(header.Value)
+		}
+	}
+	return record
+}
+
+// withoutDocumentFields returns a copy of the document without the given fields, which keeps the document of the
+// other sinks unchanged.
+func withoutDocumentFields(document map[string]any, fields []string) map[string]any {
+	if !slices.ContainsFunc(fields, func(field string) bool { _, ok := document[field]; return ok }) {
+		return document
+	}
+
+	var stripped = make(map[string]any, len(document))
+	for key, value := range document {
+		if !slices.Contains(fields, key) {
+			stripped[key] = value
+		}
+	}
+	return stripped
+}
+
+// withoutValueFields returns the given JSON object without the given fields. Other values are returned as they are.
+func withoutValueFields(value json.RawMessage, fields []string) json.RawMessage {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(value, &object); err != nil {
+		return value
+	}
+
+	var removed bool
+	for _, field := range fields {
+		if _, ok := object[field]; ok {
+			delete(object, field)
+			removed = true
+		}
+	}
+	if !removed {
+		return value
+	}
+
+	var stripped, err = json.Marshal(object)
+	if err != nil {
+		return value
+	}
+	return stripped
+}
@@ -0,0 +1,275 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"vortex/service/config"
+)
+
+const (
+	TargetFile   = "file"
+	TargetStdout = "stdout"
+)
+
+// Acknowledger is notified once documents have been written.
+type Acknowledger interface {
+	Acknowledge(messages ...*sarama.ConsumerMessage)
+	CommitOffsets()
+}
+
+// Sink writes transformed documents as NDJSON records to stdout or to local files, which are rotated once they
+// exceed a size or age. Messages written to files are acknowledged after the records have been flushed to disk,
+// messages written to stdout right away. Derived fields, which are added again when the records are replayed, are
+// not archived.
+type Sink struct {
+	config     *config.File
+	derived    []string
+	source     Acknowledger
+	mutex      sync.Mutex
+	file       *os.File
+	buffer     *bufio.Writer
+	compressor *gzip.Writer
+	output     io.Writer
+	opened     time.Time
+	written    int64
+	sequence   int
+	pending    []*sarama.ConsumerMessage
+	stop       chan bool
+	group      sync.WaitGroup
+}
+
+func NewSink(fileConfig *config.File, source Acknowledger, derived ...string) (*Sink, error) {
+	var sink = &Sink{
+		config:  fileConfig,
+		derived: derived,
+		source:  source,
+		stop:    make(chan bool),
+	}
+
+	switch fileConfig.Target {
+
+	case TargetStdout:
+		sink.buffer = bufio.NewWriter(os.Stdout)
+		sink.output = sink.buffer
+		return sink, nil
+
+	case TargetFile:
+		if len(fileConfig.Directory) == 0 {
+			return nil, errors.New("file directory must not be empty")
+		}
+		if fileConfig.MaxSizeMb < 0 || fileConfig.RotateIntervalSec < 0 {
+			return nil, errors.New("file rotation limits must not be negative")
+		}
+		if err := os.MkdirAll(fileConfig.Directory, 0o755); err != nil {
+			return nil, fmt.Errorf("could not create file directory: %w", err)
+		}
+		if err := sink.open(); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown file target '%s'", fileConfig.Target))
+
+	}
+
+	if fileConfig.FlushIntervalSec > 0 {
+		sink.group.Add(1)
+		go sink.flushWithInterval(time.Duration(fileConfig.FlushIntervalSec) * time.Second)
+	}
+	return sink, nil
+}
+
+// Send writes the document of the given message as a single line.
+func (s *Sink) Send(message *sarama.ConsumerMessage, document map[string]any) error {
+	var line, err = json.Marshal(NewRecord(message, withoutDocumentFields(document, s.derived)))
+	if err != nil {
+		return fmt.Errorf("could not encode document: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file != nil && s.isDue(int64(len(line))) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.output.Write(line); err != nil {
+		return fmt.Errorf("could not write document: %w", err)
+	}
+	s.written += int64(len(line))
+	s.pending = append(s.pending, message)
+
+	if s.file == nil {
+		return s.flush()
+	}
+	return nil
+}
+
+// isDue reports whether the current file has to be rotated before writing the given amount of bytes.
+// Empty files are never rotated, so that records exceeding the maximum size are still written.
+func (s *Sink) isDue(size int64) bool {
+	if s.written == 0 {
+		return false
+	}
+
+	var maxSize = int64(s.config.MaxSizeMb) * 1024 * 1024
+	if maxSize > 0 && s.written+size > maxSize {
+		return true
+	}
+
+	var interval = time.Duration(s.config.RotateIntervalSec) * time.Second
+	return interval > 0 && time.Since(s.opened) >= interval
+}
+
+// open creates the next file named by the prefix, the current time and a sequence number.
+func (s *Sink) open() error {
+	var extension = ".ndjson"
+	if s.config.Compress {
+		extension += ".gz"
+	}
+
+	var now = time.Now().UTC()
+	for {
+		s.sequence++
+		var name = fmt.Sprintf("%s-%s-%04d%s", s.config.Prefix, now.Format("20060102T150405Z"), s.sequence, extension)
+		var file, err = os.OpenFile(filepath.Join(s.config.Directory, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("could not create file: %w", err)
+		}
+
+		s.file = file
+		s.buffer = bufio.NewWriter(file)
+		s.output = s.buffer
+		if s.config.Compress {
+			s.compressor = gzip.NewWriter(s.buffer)
+			s.output = s.compressor
+		}
+		s.opened = now
+		s.written = 0
+		return nil
+	}
+}
+
+// close finishes the current file and acknowledges its records. Files without records are removed.
+func (s *Sink) close() error {
+	if s.compressor != nil {
+		if err := s.compressor.Close(); err != nil {
+			return fmt.Errorf("could not compress file: %w", err)
+		}
+	}
+
+	if err := s.flush(); err != nil {
+		return err
+	}
+
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("could not close file: %w", err)
+	}
+
+	if s.written == 0 {
+		return os.Remove(s.file.Name())
+	}
+	log.Info().Str("file", s.file.Name()).Int64("bytes", s.written).Msg("Completed file")
+	return nil
+}
+
+func (s *Sink) rotate() error {
+	if err := s.close(); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+// flush writes all buffered records and acknowledges their messages.
+func (s *Sink) flush() error {
+	if s.compressor != nil {
+		if err := s.compressor.Flush(); err != nil {
+			return fmt.Errorf("could not compress file: %w", err)
+		}
+	}
+
+	if err := s.buffer.Flush(); err != nil {
+		return fmt.Errorf("could not write file: %w", err)
+	}
+
+	if s.file != nil {
+		if err := s.file.Sync(); err != nil {
+			return fmt.Errorf("could not sync file: %w", err)
+		}
+	}
+
+	if len(s.pending) > 0 {
+		s.source.Acknowledge(s.pending...)
+		s.source.CommitOffsets()
+		s.pending = nil
+	}
+	return nil
+}
+
+func (s *Sink) flushWithInterval(interval time.Duration) {
+	defer s.group.Done()
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+
+		case <-ticker.C:
+			s.mutex.Lock()
+			var err error
+			if s.isDue(0) {
+				err = s.rotate()
+			} else {
+				err = s.flush()
+			}
+			s.mutex.Unlock()
+
+			if err != nil {
+				log.Fatal().Err(err).Msg("Could not flush file")
+			}
+
+		case <-s.stop:
+			return
+
+		}
+	}
+}
+
+// Close flushes all pending records and closes the current file.
+func (s *Sink) Close() {
+	close(s.stop)
+	s.group.Wait()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var err error
+	if s.file != nil {
+		err = s.close()
+	} else {
+		err = s.flush()
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Could not close file")
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package archive_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"vortex/service/archive"
+	"vortex/service/config"
+)
+
+type testAcknowledger struct {
+	acknowledged []*sarama.ConsumerMessage
+	commits      int
+}
+
+func (a *testAcknowledger) Acknowledge(messages ...*sarama.ConsumerMessage) {
+	a.acknowledged = append(a.acknowledged, messages...)
+}
+
+func (a *testAcknowledger) CommitOffsets() {
+	a.commits++
+}
+
+func newMessage(offset int64) *sarama.ConsumerMessage {
+	return &sarama.ConsumerMessage{
+		Topic:     "status",
+		Partition: 2,
+		Offset:    offset,
+		Key:       []byte("9475695c-d29c-4a91-ba5c-62a9c5a867b5"),
+		Timestamp: time.Date(2024, 1, 3, 6, 10, 35, 0, time.UTC),
+		Headers:   []*sarama.RecordHeader{{Key: []byte("type"), Value: []byte("MESSAGE")}},
+	}
+}
+
+func readRecords(t *testing.T, name string) []archive.Record {
+	var file, err = os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []archive.Record
+	var scanner = bufio.NewScanner(reader)
+	scanner.Buffer(nil, 4*1024*1024)
+	for scanner.Scan() {
+		var record archive.Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestSink(t *testing.T) {
+	var assertions = assert.New(t)
+	var acknowledger = new(testAcknowledger)
+	var directory = t.TempDir()
+
+	var sink, err = archive.NewSink(&config.File{Target: archive.TargetFile, Directory: directory, Prefix: "status", Compress: true}, acknowledger)
+	assertions.Nil(err, "expected no error")
+
+	assertions.Nil(sink.Send(newMessage(42), map[string]any{"status": "DELIVERED", "event.id": "9906d8c3"}))
+	assertions.Empty(acknowledger.acknowledged, "expected messages to be acknowledged after flushing")
+
+	sink.Close()
+	assertions.Len(acknowledger.acknowledged, 1)
+	assertions.Equal(1, acknowledger.commits)
+
+	files, _ := filepath.Glob(filepath.Join(directory, "status-*.ndjson.gz"))
+	assertions.Len(files, 1)
+
+	var records = readRecords(t, files[0])
+	assertions.Len(records, 1)
+	assertions.Equal(archive.Record{
+		Topic:     "status",
+		Partition: 2,
+		Offset:    42,
+		Timestamp: time.Date(2024, 1, 3, 6, 10, 35, 0, time.UTC),
+		Key:       "9475695c-d29c-4a91-ba5c-62a9c5a867b5",
+		Headers:   map[string]string{"type": "MESSAGE"},
+		Value:     map[string]any{"status": "DELIVERED", "event.id": "9906d8c3"},
+	}, records[0])
+}
+
+func TestSink_RotateBySize(t *testing.T) {
+	var assertions = assert.New(t)
+	var acknowledger = new(testAcknowledger)
+	var directory = t.TempDir()
+
+	var sink, err = archive.NewSink(&config.File{Target: archive.TargetFile, Directory: directory, Prefix: "status", MaxSizeMb: 1, Compress: true}, acknowledger)
+	assertions.Nil(err, "expected no error")
+
+	var payload = strings.Repeat("x", 600*1024)
+	for offset := int64(0); offset < 3; offset++ {
+		assertions.Nil(sink.Send(newMessage(offset), map[string]any{"payload": payload}))
+	}
+	assertions.Len(acknowledger.acknowledged, 2, "expected the messages of rotated files to be acknowledged")
+	sink.Close()
+
+	files, _ := filepath.Glob(filepath.Join(directory, "status-*.ndjson.gz"))
+	assertions.Len(files, 3, "expected every record to exceed the remaining size of the previous file")
+	for _, name := range files {
+		assertions.Len(readRecords(t, name), 1)
+	}
+}
+
+func TestSink_Empty(t *testing.T) {
+	var directory = t.TempDir()
+	var sink, err = archive.NewSink(&config.File{Target: archive.TargetFile, Directory: directory, Prefix: "status"}, new(testAcknowledger))
+	assert.Nil(t, err, "expected no error")
+	sink.Close()
+
+	files, _ := os.ReadDir(directory)
+	assert.Empty(t, files, "expected empty files to be removed")
+}
+
+func TestNewSink_Invalid(t *testing.T) {
+	var cases = map[string]config.File{
+		"unknown target":    {Target: "s3", Directory: "archive"},
+		"missing directory": {Target: archive.TargetFile},
+		"negative size":     {Target: archive.TargetFile, Directory: "archive", MaxSizeMb: -1},
+	}
+
+	for name, fileConfig := range cases {
+		t.Run(name, func(t *testing.T) {
+			var _, err = archive.NewSink(&fileConfig, new(testAcknowledger))
+			assert.NotNil(t, err, "expected an error")
+		})
+	}
+}
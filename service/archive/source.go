@@ -0,0 +1,288 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"vortex/service/config"
+	"vortex/service/metrics"
+	"vortex/service/utils"
+)
+
+const TypeFile = "file"
+
+// extensions are the file types read from directories, each optionally compressed with gzip.
+var extensions = []string{".json", ".ndjson", ".jsonl"}
+
+// sourceRecord is a record read by the source. Its value is kept as is to be decoded by the sink.
+type sourceRecord struct {
+	Topic     string            `json:"topic"`
+	Partition int32             `json:"partition"`
+	Offset    int64             `json:"offset"`
+	Timestamp time.Time         `json:"timestamp"`
+	Key       string            `json:"key"`
+	Headers   map[string]string `json:"headers"`
+	Value     json.RawMessage   `json:"value"`
+}
+
+// Source reads messages from NDJSON archives or JSON files instead of Kafka. Every JSON value in a file is either a
+// record (an object with a "value") or a payload, which is consumed from the default topic without key and headers.
+// Once all messages have been read and acknowledged, the source is completed. Derived fields are removed from the
+// documents of records, since they are added again while writing them.
+type Source struct {
+	config       *config.Source
+	derived      []string
+	files        []string
+	output       chan *sarama.ConsumerMessage
+	mutex        sync.Mutex
+	required     map[*sarama.ConsumerMessage]int
+	acknowledged map[*sarama.ConsumerMessage]int
+	read         bool
+	completed    chan bool
+	completion   sync.Once
+	sourceCtx    context.Context
+	sourceCancel context.CancelFunc
+}
+
+func NewSource(sourceConfig *config.Source, derived ...string) (*Source, error) {
+	var files, err = resolveFiles(sourceConfig.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	return &Source{
+		config:       sourceConfig,
+		derived:      derived,
+		files:        files,
+		output:       make(chan *sarama.ConsumerMessage),
+		required:     make(map[*sarama.ConsumerMessage]int),
+		acknowledged: make(map[*sarama.ConsumerMessage]int),
+		completed:    make(chan bool),
+		sourceCtx:    ctx,
+		sourceCancel: cancel,
+	}, nil
+}
+
+// resolveFiles returns the files matching the given path, which is a file, a directory or a glob pattern.
+// Directories are not read recursively and only contain JSON and NDJSON files.
+func resolveFiles(path string) ([]string, error) {
+	if len(path) == 0 {
+		return nil, errors.New("source path must not be empty")
+	}
+
+	var matches, err = filepath.Glob(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source path: %w", err)
+	}
+
+	var files []string
+	for _, match := range matches {
+		var info, err = os.Stat(match)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, match)
+			continue
+		}
+
+		entries, err := os.ReadDir(match)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			var extension = filepath.Ext(strings.TrimSuffix(entry.Name(), ".gz"))
+			if !entry.IsDir() && slices.Contains(extensions, extension) {
+				files = append(files, filepath.Join(match, entry.Name()))
+			}
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, errors.New(fmt.Sprintf("no files found at '%s'", path))
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+func (s *Source) Start(processGroup *sync.WaitGroup) {
+	defer processGroup.Done()
+
+	var count int
+	for _, name := range s.files {
+		var read, err = s.readFile(name, count)
+		count += read
+		if errors.Is(err, context.Canceled) {
+			return
+		} else if err != nil {
+			log.Fatal().Err(err).Str("file", name).Msg("Could not read file")
+		}
+		log.Info().Str("file", name).Int("messages", read).Msg("Read file")
+	}
+
+	s.mutex.Lock()
+	s.read = true
+	s.complete()
+	s.mutex.Unlock()
+}
+
+func (s *Source) Stop() {
+	s.sourceCancel()
+}
+
+// readFile sends the messages of the given file and returns their amount. Payloads are numbered by the given offset.
+func (s *Source) readFile(name string, offset int) (int, error) {
+	var file, err = os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var reader io.Reader = bufio.NewReader(file)
+	if strings.HasSuffix(name, ".gz") {
+		var decompressor, err = gzip.NewReader(reader)
+		if err != nil {
+			return 0, err
+		}
+		defer decompressor.Close()
+		reader = decompressor
+	}
+
+	var decoder = json.NewDecoder(reader)
+	var count int
+	for {
+		var value json.RawMessage
+		if err := decoder.Decode(&value); errors.Is(err, io.EOF) {
+			return count, nil
+		} else if err != nil {
+			return count, fmt.Errorf("invalid value #%d: %w", count+1, err)
+		}
+
+		var message = s.newMessage(value, int64(offset+count))
+		s.track(message)
+
+		select {
+		case s.output <- message:
+			log.Debug().Fields(utils.GetFieldsFromMessage(message)).Msg("Read message")
+			metrics.RecordConsumption(message)
+			count++
+
+		case <-s.sourceCtx.Done():
+			return count, s.sourceCtx.Err()
+		}
+	}
+}
+
+// newMessage returns the message of the given record or payload.
+func (s *Source) newMessage(value json.RawMessage, offset int64) *sarama.ConsumerMessage {
+	var record sourceRecord
+	if err := json.Unmarshal(value, &record); err != nil || record.Value == nil {
+		return &sarama.ConsumerMessage{Topic: s.config.Topic, Offset: offset, Value: value}
+	}
+
+	var message = &sarama.ConsumerMessage{
+		Topic:     record.Topic,
+		Partition: record.Partition,
+		Offset:    record.Offset,
+		Timestamp: record.Timestamp,
+		Value:     withoutValueFields(record.Value, s.derived),
+	}
+	if len(message.Topic) == 0 {
+		message.Topic = s.config.Topic
+	}
+	if len(record.Key) > 0 {
+		message.Key = []byte(record.Key)
+	}
+
+	// values of exported messages may be strings holding the payload or null for tombstones
+	var text *string
+	if err := json.Unmarshal(record.Value, &text); err == nil {
+		message.Value = nil
+		if text != nil {
+			message.Value = []byte(*text)
+		}
+	}
+
+	var names = make([]string, 0, len(record.Headers))
+	for name := range record.Headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		message.Headers = append(message.Headers, &sarama.RecordHeader{Key: []byte(name), Value: []byte(record.Headers[name])})
+	}
+	return message
+}
+
+func (s *Source) GetOutput() <-chan *sarama.ConsumerMessage {
+	return s.output
+}
+
+func (s *Source) track(message *sarama.ConsumerMessage) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.required[message] = 1
+}
+
+// Expect requires the given message to be acknowledged the given amount of times before it counts as processed.
+func (s *Source) Expect(message *sarama.ConsumerMessage, acknowledgements int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.required[message]; ok {
+		s.required[message] = acknowledgements
+	}
+}
+
+// Acknowledge marks the given messages as processed. Messages that are not pending are ignored.
+func (s *Source) Acknowledge(messages ...*sarama.ConsumerMessage) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, message := range messages {
+		var required, ok = s.required[message]
+		if !ok {
+			continue
+		}
+
+		s.acknowledged[message]++
+		if s.acknowledged[message] >= required {
+			delete(s.required, message)
+			delete(s.acknowledged, message)
+		}
+	}
+	s.complete()
+}
+
+// CommitOffsets does nothing, since files have no offsets.
+func (s *Source) CommitOffsets() {}
+
+// complete closes the completed channel once all messages have been read and acknowledged.
+func (s *Source) complete() {
+	if s.read && len(s.required) == 0 {
+		s.completion.Do(func() { close(s.completed) })
+	}
+}
+
+// Completed is closed once all messages have been read and acknowledged.
+func (s *Source) Completed() <-chan bool {
+	return s.completed
+}
@@ -0,0 +1,174 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package archive_test
+
+import (
+	"encoding/json"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"vortex/service/archive"
+	"vortex/service/config"
+	"vortex/service/transforms"
+)
+
+func writeFile(t *testing.T, name string, content string) {
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readAll starts the source and returns all messages it sends until no message arrived for a second.
+func readAll(source *archive.Source) []*sarama.ConsumerMessage {
+	var processGroup = new(sync.WaitGroup)
+	processGroup.Add(1)
+	go source.Start(processGroup)
+
+	var messages []*sarama.ConsumerMessage
+	for {
+		select {
+		case message := <-source.GetOutput():
+			messages = append(messages, message)
+		case <-time.After(time.Second):
+			return messages
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	var assertions = assert.New(t)
+	var directory = t.TempDir()
+
+	writeFile(t, filepath.Join(directory, "a.ndjson"),
+		`{"topic":"status","partition":1,"offset":7,"key":"9475695c","headers":{"type":"MESSAGE","tenant":"playground"},"value":{"status":"DELIVERED"}}`+"\n"+
+			`{"topic":"events","key":"9906d8c3","value":"{\"status\":\"FAILED\"}"}`+"\n"+
+			`{"key":"deleted","value":null}`+"\n")
+	payload, _ := os.ReadFile("../../testdata/kafka_msg.json")
+	writeFile(t, filepath.Join(directory, "b.json"), string(payload))
+	writeFile(t, filepath.Join(directory, "c.txt"), "ignored")
+
+	var source, err = archive.NewSource(&config.Source{Type: archive.TypeFile, Path: directory, Topic: "status"})
+	assertions.Nil(err, "expected no error")
+
+	var messages = readAll(source)
+	assertions.Len(messages, 4)
+
+	assertions.Equal(&sarama.ConsumerMessage{
+		Topic:     "status",
+		Partition: 1,
+		Offset:    7,
+		Key:       []byte("9475695c"),
+		Value:     []byte(`{"status":"DELIVERED"}`),
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("tenant"), Value: []byte("playground")},
+			{Key: []byte("type"), Value: []byte("MESSAGE")},
+		},
+	}, messages[0])
+
+	assertions.Equal("events", messages[1].Topic)
+	assertions.Equal(`{"status":"FAILED"}`, string(messages[1].Value), "expected string values to be taken as payload")
+	assertions.Equal("status", messages[2].Topic, "expected the default topic")
+	assertions.Nil(messages[2].Value, "expected null values to be tombstones")
+
+	assertions.Equal("status", messages[3].Topic)
+	assertions.Nil(messages[3].Key)
+	assertions.JSONEq(string(payload), string(messages[3].Value), "expected payloads to be read as a whole")
+
+	select {
+	case <-source.Completed():
+		t.Fatal("expected the source to wait for all acknowledgements")
+	default:
+	}
+
+	source.Expect(messages[0], 2)
+	source.Acknowledge(messages...)
+	select {
+	case <-source.Completed():
+		t.Fatal("expected the source to wait for the expected acknowledgements")
+	default:
+	}
+
+	source.Acknowledge(messages[0])
+	select {
+	case <-source.Completed():
+	case <-time.After(time.Second):
+		t.Fatal("expected the source to be completed")
+	}
+}
+
+func TestSource_Archive(t *testing.T) {
+	var assertions = assert.New(t)
+	var directory = t.TempDir()
+
+	// documents are archived as written, i.e. transformed and with the fields derived while writing them
+	var payload, _ = os.ReadFile("../../testdata/kafka_msg.json")
+	var document map[string]any
+	assertions.Nil(json.Unmarshal(payload, &document))
+	document, err := transforms.GlobalRegistry.ApplyMessageTransforms(newMessage(42), document)
+	assertions.Nil(err, "expected no error")
+	document["coordinates"] = map[string]any{"partition": 2, "offset": 42}
+	document["expireAt"] = time.Now()
+
+	var derived = []string{"coordinates", "expireAt"}
+	sink, err := archive.NewSink(&config.File{Target: archive.TargetFile, Directory: directory, Prefix: "status", Compress: true}, new(testAcknowledger), derived...)
+	assertions.Nil(err, "expected no error")
+	assertions.Nil(sink.Send(newMessage(42), document))
+	sink.Close()
+	assertions.Contains(document, "coordinates", "expected the written document to be unchanged")
+
+	// archives written before derived fields were dropped still contain them and are read first
+	legacy, err := archive.NewSink(&config.File{Target: archive.TargetFile, Directory: directory, Prefix: "legacy", Compress: true}, new(testAcknowledger))
+	assertions.Nil(err, "expected no error")
+	assertions.Nil(legacy.Send(newMessage(41), document))
+	legacy.Close()
+
+	var names, _ = filepath.Glob(filepath.Join(directory, "legacy-*"))
+	assertions.Contains(readRecords(t, names[0])[0].Value, "coordinates")
+
+	source, err := archive.NewSource(&config.Source{Type: archive.TypeFile, Path: filepath.Join(directory, "*.ndjson*"), Topic: "status"}, derived...)
+	assertions.Nil(err, "expected no error")
+
+	var messages = readAll(source)
+	assertions.Len(messages, 2)
+
+	for i, message := range messages {
+		var expected = newMessage(int64(41 + i))
+		expected.Value = message.Value
+		assertions.Equal(expected, message, "expected archived records to be restored")
+
+		var replayed map[string]any
+		assertions.Nil(json.Unmarshal(message.Value, &replayed))
+		assertions.NotContains(replayed, "coordinates", "expected derived fields to be dropped")
+		assertions.NotContains(replayed, "expireAt", "expected derived fields to be dropped")
+		assertions.Equal(document["event.id"], replayed["event.id"])
+
+		replayed, err = transforms.GlobalRegistry.ApplyMessageTransforms(message, replayed)
+		assertions.Nil(err, "expected archived documents to be transformed again")
+		for field := range replayed {
+			assertions.False(strings.HasPrefix(field, "coordinates"), "expected no coordinates in the replayed document")
+		}
+	}
+}
+
+func TestNewSource_Invalid(t *testing.T) {
+	var cases = map[string]string{
+		"empty path":   "",
+		"no files":     t.TempDir(),
+		"missing file": "missing.ndjson",
+		"invalid glob": "[",
+	}
+
+	for name, path := range cases {
+		t.Run(name, func(t *testing.T) {
+			var _, err = archive.NewSource(&config.Source{Type: archive.TypeFile, Path: path})
+			assert.NotNil(t, err, "expected an error")
+		})
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sync"
+	"time"
+	"vortex/service/config"
+	"vortex/service/mongo"
+)
+
+// maxPollBatch is the maximal amount of keys looked up per query while measuring.
+const maxPollBatch = 1000
+
+// Options control the load generated by Run.
+type Options struct {
+	Topic         string
+	Messages      int
+	Rate          int
+	Keys          int
+	Distribution  string
+	MetadataRatio float64
+	Statuses      []string
+	Seed          int64
+
+	// Measure enables polling the database until all documents appeared or Timeout has passed.
+	Measure      bool
+	Timeout      time.Duration
+	PollInterval time.Duration
+}
+
+// Validate returns an error if no load can be generated with the options.
+func (o *Options) Validate() error {
+	if len(o.Topic) == 0 {
+		return errors.New("topic must not be empty")
+	}
+
+	if o.Messages <= 0 {
+		return errors.New(fmt.Sprintf("amount of messages must be positive but is %d", o.Messages))
+	}
+
+	if o.Rate < 0 {
+		return errors.New(fmt.Sprintf("rate must not be negative but is %d", o.Rate))
+	}
+
+	if o.MetadataRatio < 0 || o.MetadataRatio > 1 {
+		return errors.New(fmt.Sprintf("metadata ratio must be between 0 and 1 but is %g", o.MetadataRatio))
+	}
+
+	if len(o.Statuses) == 0 {
+		return errors.New("statuses must not be empty")
+	}
+
+	if o.Measure && (o.Timeout <= 0 || o.PollInterval <= 0) {
+		return errors.New("timeout and poll interval must be positive when measuring")
+	}
+	return validateDistribution(o.Distribution, o.Keys)
+}
+
+// Run produces the configured amount of messages at the target rate and, if enabled, measures the time until the
+// documents appear in the database. The latency of a key is measured from its first record until its document is
+// found, so it includes up to one poll interval.
+func Run(ctx context.Context, options *Options, kafkaConfig *config.Kafka, mongoConfig *config.Mongo) (*Report, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	var generator, err = NewGenerator(options)
+	if err != nil {
+		return nil, err
+	}
+
+	var producerConfig = sarama.NewConfig()
+	producerConfig.Producer.RequiredAcks = sarama.WaitForAll
+	producerConfig.Producer.Return.Successes = true
+
+	producer, err := sarama.NewAsyncProducer(kafkaConfig.Brokers, producerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not create producer: %w", err)
+	}
+
+	var report = new(Report)
+	var tracker *tracker
+	var pollerGroup sync.WaitGroup
+	var pollerCtx, cancelPoller = context.WithCancel(ctx)
+	defer cancelPoller()
+
+	if options.Measure {
+		var client, err = mongo.Connect(ctx, mongoConfig)
+		if err != nil {
+			_ = producer.Close()
+			return nil, fmt.Errorf("could not connect to database: %w", err)
+		}
+		defer client.Disconnect(context.Background())
+
+		tracker = newTracker()
+		pollerGroup.Add(1)
+		go func() {
+			defer pollerGroup.Done()
+			tracker.poll(pollerCtx, client.Database(mongoConfig.Database).Collection(mongoConfig.Collection), options.PollInterval)
+		}()
+	}
+
+	var ackGroup sync.WaitGroup
+	ackGroup.Add(2)
+	go func() {
+		defer ackGroup.Done()
+		for range producer.Successes() {
+			report.Produced++
+		}
+	}()
+	go func() {
+		defer ackGroup.Done()
+		for err := range producer.Errors() {
+			report.Failed++
+			log.Warn().Err(err.Err).Msg("Could not produce message")
+		}
+	}()
+
+	var start = time.Now()
+	for i := 0; i < options.Messages && ctx.Err() == nil; i++ {
+		if options.Rate > 0 {
+			var due = start.Add(time.Duration(i) * time.Second / time.Duration(options.Rate))
+			if wait := time.Until(due); wait > time.Millisecond {
+				time.Sleep(wait)
+			}
+		}
+
+		var record, err = generator.Next()
+		if err != nil {
+			producer.AsyncClose()
+			return nil, err
+		}
+
+		if tracker != nil {
+			tracker.sent(record.Key, time.Now())
+		}
+
+		producer.Input() <- &sarama.ProducerMessage{
+			Topic:   options.Topic,
+			Key:     sarama.StringEncoder(record.Key),
+			Value:   sarama.ByteEncoder(record.Value),
+			Headers: []sarama.RecordHeader{{Key: []byte("type"), Value: []byte(record.Type)}},
+		}
+	}
+
+	producer.AsyncClose()
+	ackGroup.Wait()
+	report.ProduceDuration = time.Since(start)
+
+	if tracker != nil {
+		var waitCtx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+
+		select {
+		case <-tracker.done():
+		case <-waitCtx.Done():
+			log.Warn().Msg("Not all documents appeared in the database before the timeout")
+		}
+
+		cancelPoller()
+		pollerGroup.Wait()
+		tracker.report(report, start)
+	}
+
+	return report, nil
+}
+
+type documentId struct {
+	Id string `bson:"_id"`
+}
+
+// tracker records when the first record of each key was sent and when its document was found.
+type tracker struct {
+	mutex     sync.Mutex
+	pending   map[string]time.Time
+	seen      map[string]bool
+	latencies []time.Duration
+	last      time.Time
+	complete  chan struct{}
+	producing bool
+}
+
+func newTracker() *tracker {
+	return &tracker{
+		pending:   make(map[string]time.Time),
+		seen:      make(map[string]bool),
+		complete:  make(chan struct{}),
+		producing: true,
+	}
+}
+
+func (t *tracker) sent(key string, at time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.seen[key] {
+		t.seen[key] = true
+		t.pending[key] = at
+	}
+}
+
+// done stops expecting further keys and returns a channel that is closed once all pending documents were found.
+func (t *tracker) done() <-chan struct{} {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.producing = false
+	t.closeIfComplete()
+	return t.complete
+}
+
+func (t *tracker) closeIfComplete() {
+	if !t.producing && len(t.pending) == 0 {
+		select {
+		case <-t.complete:
+		default:
+			close(t.complete)
+		}
+	}
+}
+
+func (t *tracker) poll(ctx context.Context, collection *driver.Collection, interval time.Duration) {
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var keys = t.pendingKeys()
+		if len(keys) == 0 {
+			continue
+		}
+
+		var cursor, err = collection.Find(ctx, bson.M{"_id": bson.M{"$in": keys}}, options.Find().SetProjection(bson.M{"_id": 1}))
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Warn().Err(err).Msg("Could not look up documents")
+			}
+			continue
+		}
+
+		var found []documentId
+		if err := cursor.All(ctx, &found); err != nil {
+			if ctx.Err() == nil {
+				log.Warn().Err(err).Msg("Could not read documents")
+			}
+			continue
+		}
+
+		t.found(found, time.Now())
+	}
+}
+
+func (t *tracker) pendingKeys() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var keys = make([]string, 0, min(len(t.pending), maxPollBatch))
+	for key := range t.pending {
+		if len(keys) == maxPollBatch {
+			break
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (t *tracker) found(documents []documentId, at time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, document := range documents {
+		if sent, ok := t.pending[document.Id]; ok {
+			t.latencies = append(t.latencies, at.Sub(sent))
+			t.last = at
+			delete(t.pending, document.Id)
+		}
+	}
+	t.closeIfComplete()
+}
+
+func (t *tracker) report(report *Report, start time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	report.Measured = true
+	report.Observed = len(t.latencies)
+	report.Missing = len(t.pending)
+	if !t.last.IsZero() {
+		report.EndToEndDuration = t.last.Sub(start)
+	}
+	report.Latencies = newPercentiles(t.latencies)
+}
@@ -0,0 +1,117 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package bench_test
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"vortex/service/bench"
+	"vortex/service/status"
+)
+
+func newOptions() *bench.Options {
+	return &bench.Options{
+		Topic:         "status",
+		Messages:      100,
+		Keys:          10,
+		Distribution:  bench.DistributionUniform,
+		MetadataRatio: 0.5,
+		Statuses:      bench.DefaultStatuses,
+		Seed:          42,
+	}
+}
+
+func TestGenerator_Next(t *testing.T) {
+	var assertions = assert.New(t)
+	var options = newOptions()
+
+	var generator, err = bench.NewGenerator(options)
+	assertions.Nil(err, "expected no error")
+
+	var eventIds = make(map[string]string)
+	var types = make(map[string]int)
+	for i := 0; i < options.Messages; i++ {
+		record, err := generator.Next()
+		assertions.Nil(err, "expected no error")
+		types[record.Type]++
+
+		var document map[string]any
+		assertions.Nil(json.Unmarshal(record.Value, &document), "expected valid JSON")
+		assertions.Contains(bench.DefaultStatuses, document["status"])
+		assertions.Equal(record.Key, document["uuid"])
+
+		var eventId = document["event"].(map[string]any)["id"].(string)
+		if previous, ok := eventIds[record.Key]; ok {
+			assertions.Equal(previous, eventId, "expected records of the same key to share the event id")
+		}
+		eventIds[record.Key] = eventId
+
+		_, err = status.Decode(record.Value)
+		assertions.Nil(err, "expected a realistic status message")
+	}
+
+	assertions.LessOrEqual(len(eventIds), options.Keys)
+	assertions.Greater(types[bench.TypeMessage], 0)
+	assertions.Greater(types[bench.TypeMetadata], 0)
+}
+
+func TestGenerator_UniqueKeys(t *testing.T) {
+	var assertions = assert.New(t)
+	var options = newOptions()
+	options.Distribution = bench.DistributionUnique
+	options.MetadataRatio = 0
+
+	var generator, err = bench.NewGenerator(options)
+	assertions.Nil(err, "expected no error")
+
+	var keys = make(map[string]bool)
+	for i := 0; i < options.Messages; i++ {
+		record, err := generator.Next()
+		assertions.Nil(err, "expected no error")
+		assertions.Equal(bench.TypeMessage, record.Type)
+		keys[record.Key] = true
+	}
+	assertions.Len(keys, options.Messages)
+}
+
+func TestOptions_Validate(t *testing.T) {
+	var assertions = assert.New(t)
+	assertions.Nil(newOptions().Validate(), "expected options to be valid")
+
+	var invalid = []func(options *bench.Options){
+		func(options *bench.Options) { options.Topic = "" },
+		func(options *bench.Options) { options.Messages = 0 },
+		func(options *bench.Options) { options.Rate = -1 },
+		func(options *bench.Options) { options.MetadataRatio = 1.5 },
+		func(options *bench.Options) { options.Statuses = nil },
+		func(options *bench.Options) { options.Distribution = "normal" },
+		func(options *bench.Options) { options.Keys = 1 },
+		func(options *bench.Options) { options.Measure = true },
+	}
+
+	for i, modify := range invalid {
+		var options = newOptions()
+		modify(options)
+		assertions.NotNil(options.Validate(), "expected options #%d to be invalid", i+1)
+	}
+}
+
+func TestReport_String(t *testing.T) {
+	var assertions = assert.New(t)
+	var report = &bench.Report{
+		Produced:         1000,
+		ProduceDuration:  2 * time.Second,
+		Measured:         true,
+		Observed:         1000,
+		EndToEndDuration: 4 * time.Second,
+		Latencies:        bench.Percentiles{P50: 100 * time.Millisecond, P90: 200 * time.Millisecond, P99: 300 * time.Millisecond, Max: time.Second},
+	}
+
+	assertions.Equal(500.0, report.ProduceThroughput())
+	assertions.Equal(250.0, report.EndToEndThroughput())
+	assertions.Contains(report.String(), "p50 100ms, p90 200ms, p99 300ms, max 1s")
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package bench
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand"
+	"time"
+)
+
+const (
+	TypeMessage  = "MESSAGE"
+	TypeMetadata = "METADATA"
+)
+
+const (
+	DistributionUnique  = "unique"
+	DistributionUniform = "uniform"
+	DistributionZipf    = "zipf"
+)
+
+// DefaultStatuses are the statuses of Horizon status messages.
+var DefaultStatuses = []string{"PROCESSED", "WAITING", "DELIVERING", "DELIVERED", "FAILED", "DROPPED"}
+
+// The templates mirror the shapes of testdata/kafka_msg.json and testdata/kafka_dropped_msg.json.
+var (
+	//go:embed templates/message.json
+	messageTemplate []byte
+
+	//go:embed templates/metadata.json
+	metadataTemplate []byte
+)
+
+// Record is a generated Kafka record.
+type Record struct {
+	Key   string
+	Type  string
+	Value []byte
+}
+
+// Generator creates realistic Horizon status messages. MESSAGE records carry the full event including its data and
+// the HTTP headers, whereas METADATA records only update the status. Records sharing a key always share the event id,
+// since the sink upserts documents by both.
+type Generator struct {
+	options  *Options
+	random   *rand.Rand
+	zipf     *rand.Zipf
+	message  map[string]any
+	metadata map[string]any
+	keys     []identity
+}
+
+type identity struct {
+	key     string
+	eventId string
+}
+
+func NewGenerator(options *Options) (*Generator, error) {
+	var generator = &Generator{
+		options: options,
+		random:  rand.New(rand.NewSource(options.Seed)),
+	}
+
+	if err := json.Unmarshal(messageTemplate, &generator.message); err != nil {
+		return nil, fmt.Errorf("invalid message template: %w", err)
+	}
+	if err := json.Unmarshal(metadataTemplate, &generator.metadata); err != nil {
+		return nil, fmt.Errorf("invalid metadata template: %w", err)
+	}
+
+	if options.Distribution != DistributionUnique {
+		generator.keys = make([]identity, options.Keys)
+		for i := range generator.keys {
+			generator.keys[i] = identity{key: generator.uuid(), eventId: generator.uuid()}
+		}
+	}
+
+	if options.Distribution == DistributionZipf {
+		generator.zipf = rand.NewZipf(generator.random, 1.1, 1, uint64(options.Keys-1))
+	}
+	return generator, nil
+}
+
+// Next creates the next record.
+func (g *Generator) Next() (*Record, error) {
+	var id = g.nextIdentity()
+	var now = time.Now().UTC()
+
+	var recordType, template = TypeMessage, g.message
+	if g.random.Float64() < g.options.MetadataRatio {
+		recordType, template = TypeMetadata, g.metadata
+	}
+
+	var document = maps.Clone(template)
+	document["uuid"] = id.key
+	document["status"] = g.options.Statuses[g.random.Intn(len(g.options.Statuses))]
+
+	if event, ok := template["event"].(map[string]any); ok {
+		event = maps.Clone(event)
+		event["id"] = id.eventId
+		event["time"] = now.Format(time.RFC3339Nano)
+		document["event"] = event
+	}
+
+	if additionalFields, ok := template["additionalFields"].(map[string]any); ok {
+		additionalFields = maps.Clone(additionalFields)
+		additionalFields["system-horizon-event-startTime"] = now.UnixMilli()
+		document["additionalFields"] = additionalFields
+	}
+
+	var value, err = json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	return &Record{Key: id.key, Type: recordType, Value: value}, nil
+}
+
+func (g *Generator) nextIdentity() identity {
+	switch g.options.Distribution {
+
+	case DistributionUniform:
+		return g.keys[g.random.Intn(len(g.keys))]
+
+	case DistributionZipf:
+		return g.keys[g.zipf.Uint64()]
+
+	default:
+		return identity{key: g.uuid(), eventId: g.uuid()}
+
+	}
+}
+
+// uuid returns a random (version 4) UUID.
+func (g *Generator) uuid() string {
+	var bytes [16]byte
+	_, _ = g.random.Read(bytes[:])
+	bytes[6] = bytes[6]&0x0f | 0x40
+	bytes[8] = bytes[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", bytes[0:4], bytes[4:6], bytes[6:8], bytes[8:10], bytes[10:16])
+}
+
+func validateDistribution(distribution string, keys int) error {
+	switch distribution {
+
+	case DistributionUnique:
+		return nil
+
+	case DistributionUniform, DistributionZipf:
+		if keys < 2 {
+			return errors.New(fmt.Sprintf("the %s distribution requires at least 2 keys", distribution))
+		}
+		return nil
+
+	default:
+		return errors.New(fmt.Sprintf("unknown key distribution '%s'", distribution))
+
+	}
+}
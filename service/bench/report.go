@@ -0,0 +1,90 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package bench
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Report summarizes a run of the load generator.
+type Report struct {
+	Produced        int
+	Failed          int
+	ProduceDuration time.Duration
+
+	Measured         bool
+	Observed         int
+	Missing          int
+	EndToEndDuration time.Duration
+	Latencies        Percentiles
+}
+
+// Percentiles of the end-to-end latencies of all observed documents.
+type Percentiles struct {
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+func newPercentiles(latencies []time.Duration) Percentiles {
+	if len(latencies) == 0 {
+		return Percentiles{}
+	}
+
+	var sorted = slices.Clone(latencies)
+	slices.Sort(sorted)
+
+	return Percentiles{
+		P50: percentile(sorted, 0.5),
+		P90: percentile(sorted, 0.9),
+		P99: percentile(sorted, 0.99),
+		Max: sorted[len(sorted)-1],
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted values.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	var rank = int(float64(len(sorted))*p+0.5) - 1
+	return sorted[max(0, min(rank, len(sorted)-1))]
+}
+
+// ProduceThroughput returns the amount of produced messages per second.
+func (r *Report) ProduceThroughput() float64 {
+	return throughput(r.Produced, r.ProduceDuration)
+}
+
+// EndToEndThroughput returns the amount of documents that appeared in the database per second.
+func (r *Report) EndToEndThroughput() float64 {
+	return throughput(r.Observed, r.EndToEndDuration)
+}
+
+func throughput(count int, duration time.Duration) float64 {
+	if duration <= 0 {
+		return 0
+	}
+	return float64(count) / duration.Seconds()
+}
+
+func (r *Report) String() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "Produced:    %d messages (%d failed) in %s\n", r.Produced, r.Failed, r.ProduceDuration.Round(time.Millisecond))
+	fmt.Fprintf(&builder, "Throughput:  %.1f messages/s\n", r.ProduceThroughput())
+
+	if r.Measured {
+		fmt.Fprintf(&builder, "Documents:   %d observed, %d missing in %s\n", r.Observed, r.Missing, r.EndToEndDuration.Round(time.Millisecond))
+		fmt.Fprintf(&builder, "End-to-end:  %.1f documents/s\n", r.EndToEndThroughput())
+		fmt.Fprintf(&builder, "Latency:     p50 %s, p90 %s, p99 %s, max %s\n",
+			r.Latencies.P50.Round(time.Millisecond),
+			r.Latencies.P90.Round(time.Millisecond),
+			r.Latencies.P99.Round(time.Millisecond),
+			r.Latencies.Max.Round(time.Millisecond),
+		)
+	}
+	return builder.String()
+}
@@ -13,10 +13,23 @@ import (
 )
 
 type Configuration struct {
-	LogLevel string  `mapstructure:"logLevel"`
-	Metrics  Metrics `mapstructure:"metrics"`
-	Kafka    Kafka   `mapstructure:"kafka"`
-	Mongo    Mongo   `mapstructure:"mongo"`
+	LogLevel   string     `mapstructure:"logLevel"`
+	Metrics    Metrics    `mapstructure:"metrics"`
+	Source     Source     `mapstructure:"source"`
+	Kafka      Kafka      `mapstructure:"kafka"`
+	Mongo      Mongo      `mapstructure:"mongo"`
+	Tracing    Tracing    `mapstructure:"tracing"`
+	Filters    []Filter   `mapstructure:"filters"`
+	Validation Validation `mapstructure:"validation"`
+	Transforms Transforms `mapstructure:"transforms"`
+	Output     Output     `mapstructure:"output"`
+	File       File       `mapstructure:"file"`
+}
+
+type Source struct {
+	Type  string `mapstructure:"type"`
+	Path  string `mapstructure:"path"`
+	Topic string `mapstructure:"topic"`
 }
 
 type Kafka struct {
@@ -27,12 +40,82 @@ type Kafka struct {
 }
 
 type Mongo struct {
-	Url              string            `mapstructure:"url"`
-	Database         string            `mapstructure:"database"`
-	Collection       string            `mapstructure:"collection"`
-	BulkSize         int               `mapstructure:"bulkSize"`
-	FlushIntervalSec int               `mapstructure:"flushIntervalSec"`
-	WriteConcern     MongoWriteConcern `mapstructure:"writeConcern"`
+	Enabled          bool               `mapstructure:"enabled"`
+	Url              string             `mapstructure:"url"`
+	Database         string             `mapstructure:"database"`
+	Collection       string             `mapstructure:"collection"`
+	BulkSize         int                `mapstructure:"bulkSize"`
+	MaxBulkBytes     int                `mapstructure:"maxBulkBytes"`
+	MaxLingerMs      int                `mapstructure:"maxLingerMs"`
+	FlushIntervalSec int                `mapstructure:"flushIntervalSec"`
+	Writers          int                `mapstructure:"writers"`
+	Coalesce         bool               `mapstructure:"coalesce"`
+	Adaptive         MongoAdaptiveBulks `mapstructure:"adaptive"`
+	WriteConcern     MongoWriteConcern  `mapstructure:"writeConcern"`
+	Indexes          []MongoIndex       `mapstructure:"indexes"`
+	Retention        MongoRetention     `mapstructure:"retention"`
+	TypedDecoding    bool               `mapstructure:"typedDecoding"`
+	Identity         Identity           `mapstructure:"identity"`
+	Updates          []MongoUpdate      `mapstructure:"updates"`
+	SetOnInsert      []string           `mapstructure:"setOnInsert"`
+	Operators        []MongoOperator    `mapstructure:"operators"`
+}
+
+type MongoUpdate struct {
+	Type        string   `mapstructure:"type"`
+	Set         []string `mapstructure:"set"`
+	SetOnInsert []string `mapstructure:"setOnInsert"`
+}
+
+type Identity struct {
+	Components []IdentityComponent `mapstructure:"components"`
+	Fallback   []IdentityComponent `mapstructure:"fallback"`
+	Separator  string              `mapstructure:"separator"`
+	EventId    *bool               `mapstructure:"eventId"`
+	OnMissing  string              `mapstructure:"onMissing"`
+	DlqTopic   string              `mapstructure:"dlqTopic"`
+}
+
+type IdentityComponent struct {
+	Source string `mapstructure:"source"`
+	Path   string `mapstructure:"path"`
+	Header string `mapstructure:"header"`
+}
+
+type MongoOperator struct {
+	Field    string   `mapstructure:"field"`
+	Operator string   `mapstructure:"operator"`
+	From     string   `mapstructure:"from"`
+	Value    any      `mapstructure:"value"`
+	Statuses []string `mapstructure:"statuses"`
+}
+
+type MongoRetention struct {
+	Enabled    bool           `mapstructure:"enabled"`
+	Field      string         `mapstructure:"field"`
+	DefaultSec int            `mapstructure:"defaultSec"`
+	ClassesSec map[string]int `mapstructure:"classesSec"`
+	StatusSec  map[string]int `mapstructure:"statusSec"`
+}
+
+type MongoIndex struct {
+	Name               string          `mapstructure:"name"`
+	Keys               []MongoIndexKey `mapstructure:"keys"`
+	Unique             bool            `mapstructure:"unique"`
+	PartialFilter      string          `mapstructure:"partialFilter"`
+	ExpireAfterSeconds *int32          `mapstructure:"expireAfterSeconds"`
+}
+
+type MongoIndexKey struct {
+	Field string `mapstructure:"field"`
+	Order int    `mapstructure:"order"`
+}
+
+type MongoAdaptiveBulks struct {
+	Enabled         bool `mapstructure:"enabled"`
+	TargetLatencyMs int  `mapstructure:"targetLatencyMs"`
+	MinBulkSize     int  `mapstructure:"minBulkSize"`
+	MaxBulkSize     int  `mapstructure:"maxBulkSize"`
 }
 
 type MongoWriteConcern struct {
@@ -40,6 +123,135 @@ type MongoWriteConcern struct {
 	Journal bool `mapstructure:"journal"`
 }
 
+type Output struct {
+	Enabled        bool                `mapstructure:"enabled"`
+	Topic          string              `mapstructure:"topic"`
+	Key            []IdentityComponent `mapstructure:"key"`
+	KeySeparator   string              `mapstructure:"keySeparator"`
+	ForwardHeaders bool                `mapstructure:"forwardHeaders"`
+	Headers        []OutputHeader      `mapstructure:"headers"`
+	Idempotent     bool                `mapstructure:"idempotent"`
+}
+
+type OutputHeader struct {
+	Name  string `mapstructure:"name"`
+	Value string `mapstructure:"value"`
+}
+
+type File struct {
+	Enabled           bool   `mapstructure:"enabled"`
+	Target            string `mapstructure:"target"`
+	Directory         string `mapstructure:"directory"`
+	Prefix            string `mapstructure:"prefix"`
+	MaxSizeMb         int    `mapstructure:"maxSizeMb"`
+	RotateIntervalSec int    `mapstructure:"rotateIntervalSec"`
+	Compress          bool   `mapstructure:"compress"`
+	FlushIntervalSec  int    `mapstructure:"flushIntervalSec"`
+}
+
+type Validation struct {
+	Enabled  bool     `mapstructure:"enabled"`
+	Policy   string   `mapstructure:"policy"`
+	DlqTopic string   `mapstructure:"dlqTopic"`
+	Schemas  []Schema `mapstructure:"schemas"`
+}
+
+type Schema struct {
+	Topic string `mapstructure:"topic"`
+	Type  string `mapstructure:"type"`
+	File  string `mapstructure:"file"`
+}
+
+type Filter struct {
+	Name       string    `mapstructure:"name"`
+	Expression string    `mapstructure:"expression"`
+	Action     string    `mapstructure:"action"`
+	Collection string    `mapstructure:"collection"`
+	Identity   *Identity `mapstructure:"identity"`
+}
+
+type Transforms struct {
+	Flatten   Flatten          `mapstructure:"flatten"`
+	Unflatten bool             `mapstructure:"unflatten"`
+	Fields    []FieldTransform `mapstructure:"fields"`
+	Scripts   []Script         `mapstructure:"scripts"`
+	Coercions []Coercion       `mapstructure:"coercions"`
+	Headers   []HeaderMapping  `mapstructure:"headers"`
+	Redaction Redaction        `mapstructure:"redaction"`
+	Plugins   Plugins          `mapstructure:"plugins"`
+
+	ErrorPolicies map[string]string `mapstructure:"errorPolicies"`
+}
+
+type Flatten struct {
+	Separator     string   `mapstructure:"separator"`
+	MaxDepth      int      `mapstructure:"maxDepth"`
+	Include       []string `mapstructure:"include"`
+	Exclude       []string `mapstructure:"exclude"`
+	Arrays        string   `mapstructure:"arrays"`
+	JoinSeparator string   `mapstructure:"joinSeparator"`
+}
+
+type FieldTransform struct {
+	Name      string   `mapstructure:"name"`
+	Operation string   `mapstructure:"operation"`
+	Path      string   `mapstructure:"path"`
+	From      string   `mapstructure:"from"`
+	Sources   []string `mapstructure:"sources"`
+	Value     any      `mapstructure:"value"`
+	Stage     string   `mapstructure:"stage"`
+}
+
+type Script struct {
+	Name     string `mapstructure:"name"`
+	Source   string `mapstructure:"source"`
+	File     string `mapstructure:"file"`
+	MaxSteps uint64 `mapstructure:"maxSteps"`
+	Stage    string `mapstructure:"stage"`
+}
+
+type Coercion struct {
+	Path      string `mapstructure:"path"`
+	Type      string `mapstructure:"type"`
+	Format    string `mapstructure:"format"`
+	OnFailure string `mapstructure:"onFailure"`
+	Stage     string `mapstructure:"stage"`
+}
+
+type HeaderMapping struct {
+	Name      string `mapstructure:"name"`
+	Prefix    string `mapstructure:"prefix"`
+	Field     string `mapstructure:"field"`
+	Decode    string `mapstructure:"decode"`
+	OnFailure string `mapstructure:"onFailure"`
+}
+
+type Plugins struct {
+	Directory     string `mapstructure:"directory"`
+	TimeoutMs     int    `mapstructure:"timeoutMs"`
+	MemoryLimitMb int    `mapstructure:"memoryLimitMb"`
+	Stage         string `mapstructure:"stage"`
+}
+
+type Redaction struct {
+	KeyFile string          `mapstructure:"keyFile"`
+	Fields  []RedactedField `mapstructure:"fields"`
+}
+
+type RedactedField struct {
+	Path   string `mapstructure:"path"`
+	Action string `mapstructure:"action"`
+	Length int    `mapstructure:"length"`
+	Stage  string `mapstructure:"stage"`
+}
+
+type Tracing struct {
+	Enabled       bool    `mapstructure:"enabled"`
+	Endpoint      string  `mapstructure:"endpoint"`
+	ServiceName   string  `mapstructure:"serviceName"`
+	SamplingRatio float64 `mapstructure:"samplingRatio"`
+}
+
 type Metrics struct {
 	Enabled bool `mapstructure:"enabled"`
 	Port    int  `mapstructure:"port"`
@@ -52,7 +264,7 @@ func (c *Configuration) ApplyLogLevel() {
 	}
 
 	if logLevel == zerolog.DebugLevel {
-		log.Logger = log.Logger.Output(zerolog.ConsoleWriter{Out: os.Stdout})
+		log.Logger = log.Logger.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 	}
 	log.Logger = log.Level(logLevel)
 }
@@ -44,18 +44,95 @@ func setDefaults() {
 	viper.SetDefault("metrics.enabled", false)
 	viper.SetDefault("metrics.port", 8080)
 
+	viper.SetDefault("tracing.enabled", false)
+	viper.SetDefault("tracing.endpoint", "http://localhost:4318/v1/traces")
+	viper.SetDefault("tracing.serviceName", "vortex")
+	viper.SetDefault("tracing.samplingRatio", 1.0)
+
+	viper.SetDefault("filters", []map[string]any{})
+
+	viper.SetDefault("source.type", "kafka")
+	viper.SetDefault("source.path", "")
+	viper.SetDefault("source.topic", "status")
+
+	viper.SetDefault("output.enabled", false)
+	viper.SetDefault("output.topic", "")
+	viper.SetDefault("output.key", []map[string]any{{"source": "key"}})
+	viper.SetDefault("output.keySeparator", ":")
+	viper.SetDefault("output.forwardHeaders", true)
+	viper.SetDefault("output.headers", []map[string]any{})
+	viper.SetDefault("output.idempotent", true)
+
+	viper.SetDefault("file.enabled", false)
+	viper.SetDefault("file.target", "file")
+	viper.SetDefault("file.directory", "archive")
+	viper.SetDefault("file.prefix", "vortex")
+	viper.SetDefault("file.maxSizeMb", 100)
+	viper.SetDefault("file.rotateIntervalSec", 3600)
+	viper.SetDefault("file.compress", true)
+	viper.SetDefault("file.flushIntervalSec", 5)
+
+	viper.SetDefault("validation.enabled", false)
+	viper.SetDefault("validation.policy", "skip")
+	viper.SetDefault("validation.dlqTopic", "")
+	viper.SetDefault("validation.schemas", []map[string]any{})
+
+	viper.SetDefault("transforms.flatten.separator", ".")
+	viper.SetDefault("transforms.flatten.maxDepth", 0)
+	viper.SetDefault("transforms.flatten.include", []string{})
+	viper.SetDefault("transforms.flatten.exclude", []string{})
+	viper.SetDefault("transforms.flatten.arrays", "keep")
+	viper.SetDefault("transforms.flatten.joinSeparator", ",")
+	viper.SetDefault("transforms.unflatten", false)
+	viper.SetDefault("transforms.fields", []map[string]any{})
+	viper.SetDefault("transforms.scripts", []map[string]any{})
+	viper.SetDefault("transforms.coercions", []map[string]any{})
+	viper.SetDefault("transforms.headers", []map[string]any{})
+	viper.SetDefault("transforms.redaction.keyFile", "")
+	viper.SetDefault("transforms.redaction.fields", []map[string]any{})
+	viper.SetDefault("transforms.plugins.directory", "")
+	viper.SetDefault("transforms.plugins.timeoutMs", 100)
+	viper.SetDefault("transforms.plugins.memoryLimitMb", 16)
+	viper.SetDefault("transforms.plugins.stage", "after")
+	viper.SetDefault("transforms.errorPolicies", map[string]string{})
+
 	viper.SetDefault("kafka.brokers", "localhost:9092")
 	viper.SetDefault("kafka.topics", []string{"status"})
 	viper.SetDefault("kafka.groupName", "vortex")
 	viper.SetDefault("kafka.sessionTimeoutSec", 40)
 
+	viper.SetDefault("mongo.enabled", true)
 	viper.SetDefault("mongo.url", "mongodb://localhost:27017")
 	viper.SetDefault("mongo.database", "horizon")
 	viper.SetDefault("mongo.collection", "status")
 	viper.SetDefault("mongo.bulkSize", 500)
+	viper.SetDefault("mongo.maxBulkBytes", 33554432)
+	viper.SetDefault("mongo.maxLingerMs", 1000)
 	viper.SetDefault("mongo.flushIntervalSec", 30)
+	viper.SetDefault("mongo.writers", 1)
+	viper.SetDefault("mongo.coalesce", false)
+	viper.SetDefault("mongo.adaptive.enabled", false)
+	viper.SetDefault("mongo.adaptive.targetLatencyMs", 250)
+	viper.SetDefault("mongo.adaptive.minBulkSize", 50)
+	viper.SetDefault("mongo.adaptive.maxBulkSize", 5000)
 	viper.SetDefault("mongo.writeConcern.writes", 1)
 	viper.SetDefault("mongo.writeConcern.journal", false)
+	viper.SetDefault("mongo.indexes", []map[string]any{})
+	viper.SetDefault("mongo.retention.enabled", false)
+	viper.SetDefault("mongo.retention.field", "expireAt")
+	viper.SetDefault("mongo.retention.defaultSec", 604800)
+	viper.SetDefault("mongo.retention.classesSec", map[string]int{"default": 604800})
+	viper.SetDefault("mongo.retention.statusSec", map[string]int{})
+	viper.SetDefault("mongo.typedDecoding", false)
+	viper.SetDefault("mongo.identity.components", []map[string]any{{"source": "key"}})
+	viper.SetDefault("mongo.identity.fallback", []map[string]any{})
+	viper.SetDefault("mongo.identity.separator", ":")
+	viper.SetDefault("mongo.identity.eventId", true)
+	viper.SetDefault("mongo.identity.onMissing", "skip")
+	viper.SetDefault("mongo.identity.dlqTopic", "")
+	viper.SetDefault("mongo.updates", []map[string]any{})
+	viper.SetDefault("mongo.setOnInsert", []string{})
+	viper.SetDefault("mongo.operators", []map[string]any{})
 }
 
 func readConfiguration() {
@@ -0,0 +1,22 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package dlq holds what the stages rejecting messages (e.g. validation and identity) share about their handling.
+package dlq
+
+import (
+	"github.com/IBM/sarama"
+)
+
+// Policies of rejected messages, which are either skipped, forwarded to a dead letter queue or fail the consumer.
+const (
+	PolicySkip = "skip"
+	PolicyDlq  = "dlq"
+	PolicyFail = "fail"
+)
+
+// Forwarder sends consumed messages to another topic. See kafka.Producer.
+type Forwarder interface {
+	Forward(topic string, message *sarama.ConsumerMessage, headers ...sarama.RecordHeader) error
+}
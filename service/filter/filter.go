@@ -0,0 +1,158 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/google/cel-go/cel"
+	"github.com/rs/zerolog/log"
+	"slices"
+	"vortex/service/config"
+)
+
+const (
+	ActionDrop  = "drop"
+	ActionRoute = "route"
+)
+
+// Decision is the outcome of evaluating all rules for a message. Without a matching rule the message is kept
+// and written to the default collection.
+type Decision struct {
+	Rule       string
+	Drop       bool
+	Collection string
+}
+
+type rule struct {
+	name       string
+	action     string
+	collection string
+	program    cel.Program
+}
+
+// Filter evaluates CEL expressions against the parsed document and the metadata of a message.
+// Rules are evaluated in order and the first matching rule determines the decision.
+type Filter struct {
+	rules []*rule
+}
+
+func NewFilter(rules []config.Filter) (*Filter, error) {
+	var env, err = cel.NewEnv(
+		cel.Variable("document", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("topic", cel.StringType),
+		cel.Variable("key", cel.StringType),
+		cel.Variable("headers", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("partition", cel.IntType),
+		cel.Variable("offset", cel.IntType),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var filter = &Filter{rules: make([]*rule, 0, len(rules))}
+	for _, ruleConfig := range rules {
+		compiled, err := compile(env, ruleConfig)
+		if err != nil {
+			return nil, err
+		}
+		filter.rules = append(filter.rules, compiled)
+	}
+	return filter, nil
+}
+
+func compile(env *cel.Env, ruleConfig config.Filter) (*rule, error) {
+	switch ruleConfig.Action {
+
+	case ActionDrop:
+
+	case ActionRoute:
+		if len(ruleConfig.Collection) == 0 {
+			return nil, errors.New(fmt.Sprintf("filter '%s' routes messages but has no collection", ruleConfig.Name))
+		}
+
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown action '%s' of filter '%s'", ruleConfig.Action, ruleConfig.Name))
+
+	}
+
+	ast, issues := env.Compile(ruleConfig.Expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("could not compile filter '%s': %w", ruleConfig.Name, issues.Err())
+	}
+
+	if ast.OutputType() != cel.BoolType {
+		return nil, errors.New(fmt.Sprintf("expression of filter '%s' does not evaluate to a boolean", ruleConfig.Name))
+	}
+
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rule{
+		name:       ruleConfig.Name,
+		action:     ruleConfig.Action,
+		collection: ruleConfig.Collection,
+		program:    program,
+	}, nil
+}
+
+// Collections returns the distinct collections messages may be routed to in the order of the rules.
+func (f *Filter) Collections() []string {
+	if f == nil {
+		return nil
+	}
+
+	var collections = make([]string, 0)
+	for _, r := range f.rules {
+		if r.action == ActionRoute && !slices.Contains(collections, r.collection) {
+			collections = append(collections, r.collection)
+		}
+	}
+	return collections
+}
+
+func (f *Filter) Evaluate(message *sarama.ConsumerMessage, document map[string]any) Decision {
+	if f == nil || len(f.rules) == 0 {
+		return Decision{}
+	}
+
+	var activation = map[string]any{
+		"document":  document,
+		"topic":     message.Topic,
+		"key":       string(message.Key),
+		"headers":   headerMap(message.Headers),
+		"partition": int64(message.Partition),
+		"offset":    message.Offset,
+	}
+
+	for _, r := range f.rules {
+		result, _, err := r.program.Eval(activation)
+		if err != nil {
+			log.Warn().Err(err).Str("filter", r.name).Int64("offset", message.Offset).Msg("Could not evaluate filter. Treating it as not matching!")
+			continue
+		}
+
+		if matches, ok := result.Value().(bool); ok && matches {
+			return Decision{
+				Rule:       r.name,
+				Drop:       r.action == ActionDrop,
+				Collection: r.collection,
+			}
+		}
+	}
+
+	return Decision{}
+}
+
+func headerMap(headers []*sarama.RecordHeader) map[string]string {
+	var mapped = make(map[string]string, len(headers))
+	for _, header := range headers {
+		mapped[string(header.Key)] = string(header.Value)
+	}
+	return mapped
+}
@@ -0,0 +1,90 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package filter_test
+
+import (
+	"encoding/json"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"vortex/service/config"
+	"vortex/service/filter"
+)
+
+var testMessage = &sarama.ConsumerMessage{
+	Topic:     "status",
+	Key:       []byte("9475695c-d29c-4a91-ba5c-62a9c5a867b5"),
+	Partition: 1,
+	Offset:    42,
+	Headers: []*sarama.RecordHeader{
+		{Key: []byte("type"), Value: []byte("METADATA")},
+	},
+}
+
+func TestFilter_Evaluate(t *testing.T) {
+	var assertions = assert.New(t)
+	var document = mustReadJson("../../testdata/kafka_msg.json")
+
+	var messageFilter, err = filter.NewFilter([]config.Filter{
+		{Name: "metadata", Expression: `headers["type"] == "METADATA" && partition == 0`, Action: filter.ActionDrop},
+		{Name: "callbacks", Expression: `document.deliveryType == "CALLBACK"`, Action: filter.ActionRoute, Collection: "callbacks"},
+		{Name: "playground", Expression: `has(document.environment) && document.environment == "playground"`, Action: filter.ActionDrop},
+	})
+	assertions.Nil(err, "expected no error")
+
+	var decision = messageFilter.Evaluate(testMessage, document)
+	assertions.Equal(filter.Decision{Rule: "callbacks", Collection: "callbacks"}, decision, "expected first matching rule to win")
+
+	document["deliveryType"] = "SSE"
+	decision = messageFilter.Evaluate(testMessage, document)
+	assertions.Equal(filter.Decision{Rule: "playground", Drop: true}, decision)
+
+	document["environment"] = "production"
+	decision = messageFilter.Evaluate(testMessage, document)
+	assertions.Equal(filter.Decision{}, decision, "expected message to be kept")
+}
+
+func TestFilter_EvaluationError(t *testing.T) {
+	var assertions = assert.New(t)
+	var messageFilter, err = filter.NewFilter([]config.Filter{
+		{Name: "missing", Expression: `document.missing == "value"`, Action: filter.ActionDrop},
+	})
+	assertions.Nil(err, "expected no error")
+
+	var decision = messageFilter.Evaluate(testMessage, map[string]any{})
+	assertions.False(decision.Drop, "expected failing rules to not match")
+}
+
+func TestNewFilter_Invalid(t *testing.T) {
+	var assertions = assert.New(t)
+	var cases = map[string]config.Filter{
+		"syntax":     {Name: "syntax", Expression: `document.status ==`, Action: filter.ActionDrop},
+		"type":       {Name: "type", Expression: `topic`, Action: filter.ActionDrop},
+		"action":     {Name: "action", Expression: `true`, Action: "ignore"},
+		"collection": {Name: "collection", Expression: `true`, Action: filter.ActionRoute},
+	}
+
+	for name, rule := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := filter.NewFilter([]config.Filter{rule})
+			assertions.NotNil(err, "expected an error")
+		})
+	}
+}
+
+func mustReadJson(filename string) map[string]any {
+	bytes, err := os.ReadFile(filename)
+	if err != nil {
+		panic(err)
+	}
+
+	var data = make(map[string]any)
+	if err := json.Unmarshal(bytes, &data); err != nil {
+		panic(err)
+	}
+
+	return data
+}
@@ -0,0 +1,309 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"strconv"
+	"strings"
+	"vortex/service/config"
+	"vortex/service/dlq"
+	"vortex/service/filter"
+	"vortex/service/utils"
+)
+
+const (
+	SourceKey    = "key"
+	SourcePath   = "path"
+	SourceHeader = "header"
+)
+
+const DefaultSeparator = ":"
+
+// ErrorHeader is the record header carrying the missing component of messages forwarded to the dead letter queue.
+const ErrorHeader = "vortex-identity-error"
+
+// ErrMissingComponent is returned if a message lacks a component of its identity.
+var ErrMissingComponent = errors.New("missing identity component")
+
+var eventIdPath = utils.MustParsePath("event.id")
+
+type component struct {
+	source string
+	path   *utils.Path
+	header string
+}
+
+func (c component) String() string {
+	switch c.source {
+
+	case SourcePath:
+		return fmt.Sprintf("path '%s'", c.path)
+
+	case SourceHeader:
+		return fmt.Sprintf("header '%s'", c.header)
+
+	default:
+		return c.source
+
+	}
+}
+
+// Identity determines the filter of the document a message is upserted into. The _id is formed by joining the
+// values of its components, which are either the key, values of the payload or record headers. If one of them is
+// missing or empty, the fallback components are used instead. If required, event.id is part of the filter as well.
+type Identity struct {
+	components []component
+	fallback   []component
+	separator  string
+	eventId    bool
+	onMissing  string
+	dlqTopic   string
+	forwarder  dlq.Forwarder
+}
+
+func New(identityConfig *config.Identity, forwarder dlq.Forwarder) (*Identity, error) {
+	var identity = &Identity{
+		separator: identityConfig.Separator,
+		eventId:   identityConfig.EventId == nil || *identityConfig.EventId,
+		onMissing: identityConfig.OnMissing,
+		dlqTopic:  identityConfig.DlqTopic,
+		forwarder: forwarder,
+	}
+
+	if len(identity.separator) == 0 {
+		identity.separator = DefaultSeparator
+	}
+
+	switch identity.onMissing {
+
+	case "":
+		identity.onMissing = dlq.PolicySkip
+
+	case dlq.PolicySkip, dlq.PolicyFail:
+
+	case dlq.PolicyDlq:
+		if len(identity.dlqTopic) == 0 || forwarder == nil {
+			return nil, errors.New("forwarding messages with missing identity requires a dead letter topic")
+		}
+
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown policy '%s' for missing identities", identity.onMissing))
+
+	}
+
+	var err error
+	if identity.components, err = compileComponents(identityConfig.Components); err != nil {
+		return nil, err
+	}
+	if len(identity.components) == 0 {
+		identity.components = []component{{source: SourceKey}}
+	}
+
+	if identity.fallback, err = compileComponents(identityConfig.Fallback); err != nil {
+		return nil, fmt.Errorf("invalid fallback: %w", err)
+	}
+	return identity, nil
+}
+
+func compileComponents(componentConfigs []config.IdentityComponent) ([]component, error) {
+	var components = make([]component, 0, len(componentConfigs))
+	for i, componentConfig := range componentConfigs {
+		var compiled = component{source: componentConfig.Source}
+
+		switch componentConfig.Source {
+
+		case SourceKey:
+
+		case SourcePath:
+			var path, err = utils.ParsePath(componentConfig.Path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path of identity component #%d: %w", i+1, err)
+			}
+			compiled.path = path
+
+		case SourceHeader:
+			if len(componentConfig.Header) == 0 {
+				return nil, errors.New(fmt.Sprintf("identity component #%d has no header", i+1))
+			}
+			compiled.header = componentConfig.Header
+
+		default:
+			return nil, errors.New(fmt.Sprintf("unknown source '%s' of identity component #%d", componentConfig.Source, i+1))
+
+		}
+		components = append(components, compiled)
+	}
+	return components, nil
+}
+
+// IsDefault reports whether the identity consists of the key and event.id only, which is the identity assumed by
+// typed decoding.
+func (i *Identity) IsDefault() bool {
+	return len(i.components) == 1 && i.components[0].source == SourceKey && len(i.fallback) == 0 && i.eventId
+}
+
+// Filter returns the filter of the document the message is upserted into. The document is the payload before any
+// transformation has been applied. An error wrapping ErrMissingComponent is returned if a component is missing.
+func (i *Identity) Filter(message *sarama.ConsumerMessage, document map[string]any) (bson.M, error) {
+	var id, err = i.Key(message, document)
+	if err != nil {
+		return nil, err
+	}
+
+	var filter = bson.M{"_id": id}
+	if i.eventId {
+		var eventId, ok = eventIdPath.Get(document)
+		if !ok {
+			return nil, fmt.Errorf("%w: path 'event.id'", ErrMissingComponent)
+		}
+		filter["event.id"] = eventId
+	}
+	return filter, nil
+}
+
+// Key joins the values of the components, falling back to the fallback components if one of them is missing.
+// An error wrapping ErrMissingComponent is returned if neither are complete.
+func (i *Identity) Key(message *sarama.ConsumerMessage, document map[string]any) (string, error) {
+	var key, err = i.join(i.components, message, document)
+	if err != nil && len(i.fallback) > 0 {
+		return i.join(i.fallback, message, document)
+	}
+	return key, err
+}
+
+func (i *Identity) join(components []component, message *sarama.ConsumerMessage, document map[string]any) (string, error) {
+	var values = make([]string, len(components))
+	for index, c := range components {
+		var value = c.value(message, document)
+		if len(value) == 0 {
+			return "", fmt.Errorf("%w: %s", ErrMissingComponent, c)
+		}
+		values[index] = value
+	}
+	return strings.Join(values, i.separator), nil
+}
+
+func (c component) value(message *sarama.ConsumerMessage, document map[string]any) string {
+	switch c.source {
+
+	case SourceKey:
+		return string(message.Key)
+
+	case SourceHeader:
+		return utils.GetHeader(message.Headers, c.header)
+
+	default:
+		var value, _ = c.path.Get(document)
+		return stringify(value)
+
+	}
+}
+
+// stringify converts scalar values of the payload to strings. Objects, arrays and null are treated as missing.
+func stringify(value any) string {
+	switch casted := value.(type) {
+
+	case string:
+		return casted
+
+	case float64:
+		return strconv.FormatFloat(casted, 'f', -1, 64)
+
+	case bool:
+		return strconv.FormatBool(casted)
+
+	default:
+		return ""
+
+	}
+}
+
+// Reject handles a message with a missing identity component according to the policy. An error is returned if the
+// message must not be acknowledged, either because of the policy or because it could not be forwarded.
+func (i *Identity) Reject(message *sarama.ConsumerMessage, missing error) error {
+	log.Warn().Fields(utils.GetFieldsFromMessage(message)).
+		Str("policy", i.onMissing).
+		Str("error", missing.Error()).
+		Msg("Detected faulty message")
+
+	switch i.onMissing {
+
+	case dlq.PolicyDlq:
+		var header = sarama.RecordHeader{Key: []byte(ErrorHeader), Value: []byte(missing.Error())}
+		if err := i.forwarder.Forward(i.dlqTopic, message, header); err != nil {
+			return fmt.Errorf("could not forward faulty message to '%s': %w", i.dlqTopic, err)
+		}
+		return nil
+
+	case dlq.PolicyFail:
+		return missing
+
+	default:
+		return nil
+
+	}
+}
+
+// Routes holds the identities of the routes of a filter. Messages without a route use the default identity.
+type Routes struct {
+	defaultIdentity *Identity
+	routes          map[string]*Identity
+}
+
+func NewRoutes(defaultConfig *config.Identity, filters []config.Filter, forwarder dlq.Forwarder) (*Routes, error) {
+	var defaultIdentity, err = New(defaultConfig, forwarder)
+	if err != nil {
+		return nil, err
+	}
+
+	var routes = &Routes{defaultIdentity: defaultIdentity, routes: make(map[string]*Identity)}
+	for _, filterConfig := range filters {
+		if filterConfig.Identity == nil {
+			continue
+		}
+
+		if filterConfig.Action != filter.ActionRoute {
+			return nil, errors.New(fmt.Sprintf("filter '%s' does not route messages and cannot have an identity", filterConfig.Name))
+		}
+
+		routeIdentity, err := New(filterConfig.Identity, forwarder)
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity of filter '%s': %w", filterConfig.Name, err)
+		}
+		routes.routes[filterConfig.Name] = routeIdentity
+	}
+	return routes, nil
+}
+
+// For returns the identity of the route of the given filter rule or the default identity.
+func (r *Routes) For(rule string) *Identity {
+	if identity, ok := r.routes[rule]; ok {
+		return identity
+	}
+	return r.defaultIdentity
+}
+
+// IsDefault reports whether all messages are identified by their key and event.id.
+func (r *Routes) IsDefault() bool {
+	return len(r.routes) == 0 && r.defaultIdentity.IsDefault()
+}
+
+// UsesDlq reports whether the given configuration forwards messages with missing identities to a dead letter queue.
+func UsesDlq(defaultConfig *config.Identity, filters []config.Filter) bool {
+	if defaultConfig.OnMissing == dlq.PolicyDlq {
+		return true
+	}
+	for _, filterConfig := range filters {
+		if filterConfig.Identity != nil && filterConfig.Identity.OnMissing == dlq.PolicyDlq {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package identity_test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"os"
+	"testing"
+	"vortex/service/config"
+	"vortex/service/dlq"
+	"vortex/service/identity"
+)
+
+var testMessage = &sarama.ConsumerMessage{
+	Topic: "status",
+	Key:   []byte("9475695c-d29c-4a91-ba5c-62a9c5a867b5"),
+	Headers: []*sarama.RecordHeader{
+		{Key: []byte("type"), Value: []byte("MESSAGE")},
+		{Key: []byte("tenant"), Value: []byte("playground")},
+	},
+}
+
+type testForwarder struct {
+	topics  []string
+	headers [][]sarama.RecordHeader
+}
+
+func (f *testForwarder) Forward(topic string, message *sarama.ConsumerMessage, headers ...sarama.RecordHeader) error {
+	f.topics = append(f.topics, topic)
+	f.headers = append(f.headers, headers)
+	return nil
+}
+
+func TestIdentity_Default(t *testing.T) {
+	var assertions = assert.New(t)
+
+	var id, err = identity.New(&config.Identity{}, nil)
+	assertions.Nil(err, "expected no error")
+	assertions.True(id.IsDefault(), "expected key and event.id to be the default identity")
+
+	filter, err := id.Filter(testMessage, mustReadJson("../../testdata/kafka_msg.json"))
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(bson.M{"_id": "9475695c-d29c-4a91-ba5c-62a9c5a867b5", "event.id": "9906d8c3-b965-4f00-9f98-ae9c96565009"}, filter)
+}
+
+func TestIdentity_Components(t *testing.T) {
+	var assertions = assert.New(t)
+	var eventId = false
+
+	var id, err = identity.New(&config.Identity{
+		Components: []config.IdentityComponent{
+			{Source: identity.SourceHeader, Header: "tenant"},
+			{Source: identity.SourcePath, Path: "subscriptionId"},
+			{Source: identity.SourcePath, Path: "additionalFields.system-horizon-event-startTime"},
+		},
+		Separator: "/",
+		EventId:   &eventId,
+	}, nil)
+	assertions.Nil(err, "expected no error")
+	assertions.False(id.IsDefault(), "expected a custom identity")
+
+	filter, err := id.Filter(testMessage, mustReadJson("../../testdata/kafka_msg.json"))
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(bson.M{"_id": "playground/0df6658da8ecfa2da46ab6cbf9010db601454b2f/1704262235592"}, filter)
+}
+
+func TestIdentity_Fallback(t *testing.T) {
+	var assertions = assert.New(t)
+	var message = &sarama.ConsumerMessage{Topic: "status"}
+
+	var id, err = identity.New(&config.Identity{
+		Fallback: []config.IdentityComponent{{Source: identity.SourcePath, Path: "uuid"}},
+	}, nil)
+	assertions.Nil(err, "expected no error")
+
+	filter, err := id.Filter(message, mustReadJson("../../testdata/kafka_msg.json"))
+	assertions.Nil(err, "expected no error")
+	assertions.Equal("9475695c-d29c-4a91-ba5c-62a9c5a867b5", filter["_id"], "expected the uuid to be used for the empty key")
+}
+
+func TestIdentity_Key(t *testing.T) {
+	var assertions = assert.New(t)
+	var id, _ = identity.New(&config.Identity{
+		Components: []config.IdentityComponent{{Source: identity.SourceKey}, {Source: identity.SourceHeader, Header: "tenant"}},
+		Fallback:   []config.IdentityComponent{{Source: identity.SourcePath, Path: "uuid"}},
+	}, nil)
+
+	key, err := id.Key(testMessage, map[string]any{})
+	assertions.Nil(err, "expected no error")
+	assertions.Equal("9475695c-d29c-4a91-ba5c-62a9c5a867b5:playground", key)
+
+	key, err = id.Key(&sarama.ConsumerMessage{}, map[string]any{"uuid": "fallback"})
+	assertions.Nil(err, "expected no error")
+	assertions.Equal("fallback", key, "expected the fallback to be used for the missing key")
+
+	_, err = id.Key(&sarama.ConsumerMessage{}, map[string]any{})
+	assertions.True(errors.Is(err, identity.ErrMissingComponent), "expected missing components to be reported")
+}
+
+func TestIdentity_Missing(t *testing.T) {
+	var assertions = assert.New(t)
+	var id, _ = identity.New(&config.Identity{}, nil)
+
+	var _, err = id.Filter(&sarama.ConsumerMessage{}, mustReadJson("../../testdata/kafka_msg.json"))
+	assertions.True(errors.Is(err, identity.ErrMissingComponent), "expected the empty key to be missing")
+
+	_, err = id.Filter(testMessage, map[string]any{"event": "not an object"})
+	assertions.True(errors.Is(err, identity.ErrMissingComponent), "expected event.id to be missing")
+	assertions.Nil(id.Reject(testMessage, err), "expected faulty messages to be skipped by default")
+}
+
+func TestIdentity_Reject(t *testing.T) {
+	var assertions = assert.New(t)
+	var missing = errors.New("missing identity component: key")
+
+	fail, err := identity.New(&config.Identity{OnMissing: dlq.PolicyFail}, nil)
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(missing, fail.Reject(testMessage, missing))
+
+	var forwarder = new(testForwarder)
+	dlq, err := identity.New(&config.Identity{OnMissing: dlq.PolicyDlq, DlqTopic: "status-dlq"}, forwarder)
+	assertions.Nil(err, "expected no error")
+	assertions.Nil(dlq.Reject(testMessage, missing))
+	assertions.Equal([]string{"status-dlq"}, forwarder.topics)
+	assertions.Equal(identity.ErrorHeader, string(forwarder.headers[0][0].Key))
+}
+
+func TestNew_Invalid(t *testing.T) {
+	var cases = map[string]*config.Identity{
+		"unknown source":    {Components: []config.IdentityComponent{{Source: "partition"}}},
+		"invalid path":      {Components: []config.IdentityComponent{{Source: identity.SourcePath, Path: "a..b"}}},
+		"missing header":    {Components: []config.IdentityComponent{{Source: identity.SourceHeader}}},
+		"unknown policy":    {OnMissing: "ignore"},
+		"dlq without topic": {OnMissing: dlq.PolicyDlq},
+	}
+
+	for name, identityConfig := range cases {
+		t.Run(name, func(t *testing.T) {
+			var _, err = identity.New(identityConfig, new(testForwarder))
+			assert.NotNil(t, err, "expected an error")
+		})
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	var assertions = assert.New(t)
+	var eventId = false
+	var filters = []config.Filter{
+		{Name: "metadata", Action: "route", Collection: "metadata", Identity: &config.Identity{EventId: &eventId}},
+		{Name: "playground", Action: "drop"},
+	}
+
+	var routes, err = identity.NewRoutes(&config.Identity{}, filters, nil)
+	assertions.Nil(err, "expected no error")
+	assertions.False(routes.IsDefault(), "expected routes with identities to not be default")
+	assertions.False(routes.For("metadata").IsDefault())
+	assertions.True(routes.For("playground").IsDefault(), "expected the default identity for rules without one")
+	assertions.True(routes.For("").IsDefault(), "expected the default identity without a matching rule")
+
+	filters[1].Identity = &config.Identity{}
+	_, err = identity.NewRoutes(&config.Identity{}, filters, nil)
+	assertions.NotNil(err, "expected identities of dropping filters to be rejected")
+}
+
+func mustReadJson(filename string) map[string]any {
+	bytes, err := os.ReadFile(filename)
+	if err != nil {
+		panic(err)
+	}
+
+	var data = make(map[string]any)
+	if err := json.Unmarshal(bytes, &data); err != nil {
+		panic(err)
+	}
+
+	return data
+}
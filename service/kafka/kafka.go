@@ -24,6 +24,9 @@ type Consumer struct {
 	reBalanceChannel chan bool
 	consumerCtx      context.Context
 	consumerCancel   context.CancelFunc
+	tracker          *OffsetTracker
+	session          sarama.ConsumerGroupSession
+	sessionMutex     sync.RWMutex
 }
 
 func NewConsumer(config *config.Kafka) (*Consumer, error) {
@@ -46,6 +49,7 @@ func NewConsumer(config *config.Kafka) (*Consumer, error) {
 		commitChannel:  make(chan bool),
 		consumerCtx:    ctx,
 		consumerCancel: cancel,
+		tracker:        NewOffsetTracker(),
 	}, nil
 }
 
@@ -69,6 +73,12 @@ func (c *Consumer) Stop() {
 func (c *Consumer) Setup(session sarama.ConsumerGroupSession) error {
 	var fields = utils.GetFieldsFromClaims(session.Claims())
 	log.Info().Fields(fields).Msg("Received assignment from Kafka")
+
+	c.sessionMutex.Lock()
+	c.session = session
+	c.tracker.Reset()
+	c.sessionMutex.Unlock()
+
 	return c.seekToLastCommittedOffset(session)
 }
 
@@ -95,9 +105,9 @@ func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim saram
 
 		case message := <-claim.Messages():
 			if message != nil {
+				c.tracker.Track(message)
 				c.dataChannel <- message
 				log.Debug().Fields(utils.GetFieldsFromMessage(message)).Msg("Consumed message")
-				session.MarkMessage(message, "")
 				metrics.RecordConsumption(message)
 			}
 
@@ -119,6 +129,26 @@ func (c *Consumer) GetOutput() <-chan *sarama.ConsumerMessage {
 	return c.dataChannel
 }
 
+// Acknowledge marks the given messages as processed. Offsets are only marked for commit once all
+// preceding messages of the same partition have been acknowledged as well.
+func (c *Consumer) Acknowledge(messages ...*sarama.ConsumerMessage) {
+	c.sessionMutex.RLock()
+	defer c.sessionMutex.RUnlock()
+
+	if c.session == nil {
+		return
+	}
+
+	for _, message := range c.tracker.Acknowledge(messages...) {
+		c.session.MarkMessage(message, "")
+	}
+}
+
+// Expect requires the given message to be acknowledged the given amount of times before its offset may be committed.
+func (c *Consumer) Expect(message *sarama.ConsumerMessage, acknowledgements int) {
+	c.tracker.Expect(message, acknowledgements)
+}
+
 func (c *Consumer) CommitOffsets() {
 	go func() {
 		c.commitChannel <- true
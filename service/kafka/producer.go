@@ -0,0 +1,54 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package kafka
+
+import (
+	"github.com/IBM/sarama"
+	"github.com/rs/zerolog/log"
+	"slices"
+	"vortex/service/config"
+)
+
+// Producer forwards consumed messages to other topics (e.g. a dead letter queue). Messages are sent synchronously,
+// so that a consumed message is only acknowledged once it has been forwarded.
+type Producer struct {
+	producer sarama.SyncProducer
+}
+
+func NewProducer(config *config.Kafka) (*Producer, error) {
+	var producerConfig = sarama.NewConfig()
+	producerConfig.Producer.RequiredAcks = sarama.WaitForAll
+	producerConfig.Producer.Return.Successes = true
+
+	var producer, err = sarama.NewSyncProducer(config.Brokers, producerConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &Producer{producer: producer}, nil
+}
+
+// Forward sends the key, value and headers of the consumed message to the given topic. The additional headers
+// are appended to the ones of the message.
+func (p *Producer) Forward(topic string, message *sarama.ConsumerMessage, headers ...sarama.RecordHeader) error {
+	var recordHeaders = make([]sarama.RecordHeader, 0, len(message.Headers)+len(headers))
+	for _, header := range message.Headers {
+		recordHeaders = append(recordHeaders, sarama.RecordHeader{Key: slices.Clone(header.Key), Value: slices.Clone(header.Value)})
+	}
+	recordHeaders = append(recordHeaders, headers...)
+
+	var _, _, err = p.producer.SendMessage(&sarama.ProducerMessage{
+		Topic:   topic,
+		Key:     sarama.ByteEncoder(message.Key),
+		Value:   sarama.ByteEncoder(message.Value),
+		Headers: recordHeaders,
+	})
+	return err
+}
+
+func (p *Producer) Close() {
+	if err := p.producer.Close(); err != nil {
+		log.Error().Err(err).Msg("Could not close producer")
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/rs/zerolog/log"
+	"slices"
+	"sync"
+	"vortex/service/config"
+	"vortex/service/identity"
+	"vortex/service/metrics"
+	"vortex/service/utils"
+)
+
+// Acknowledger is notified once records have been produced.
+type Acknowledger interface {
+	Acknowledge(messages ...*sarama.ConsumerMessage)
+	CommitOffsets()
+}
+
+// Sink produces transformed documents as JSON to an output topic. Records are produced asynchronously and the
+// consumed message is acknowledged once its record has been written, so that its offset is only committed afterward.
+type Sink struct {
+	producer sarama.AsyncProducer
+	config   *config.Output
+	key      *identity.Identity
+	headers  []sarama.RecordHeader
+	source   Acknowledger
+	group    sync.WaitGroup
+}
+
+func NewSink(outputConfig *config.Output, kafkaConfig *config.Kafka, source Acknowledger) (*Sink, error) {
+	if len(outputConfig.Topic) == 0 {
+		return nil, errors.New("output topic must not be empty")
+	}
+
+	var eventId = false
+	var key, err = identity.New(&config.Identity{
+		Components: outputConfig.Key,
+		Separator:  outputConfig.KeySeparator,
+		EventId:    &eventId,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output key: %w", err)
+	}
+
+	var headers = make([]sarama.RecordHeader, len(outputConfig.Headers))
+	for i, header := range outputConfig.Headers {
+		if len(header.Name) == 0 {
+			return nil, errors.New(fmt.Sprintf("output header #%d has no name", i+1))
+		}
+		headers[i] = sarama.RecordHeader{Key: []byte(header.Name), Value: []byte(header.Value)}
+	}
+
+	var producerConfig = sarama.NewConfig()
+	producerConfig.Producer.RequiredAcks = sarama.WaitForAll
+	producerConfig.Producer.Return.Successes = true
+	producerConfig.Producer.Return.Errors = true
+	if outputConfig.Idempotent {
+		// idempotence requires a single in-flight request per broker to keep the order of records
+		producerConfig.Producer.Idempotent = true
+		producerConfig.Net.MaxOpenRequests = 1
+	}
+
+	producer, err := sarama.NewAsyncProducer(kafkaConfig.Brokers, producerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not create output producer: %w", err)
+	}
+
+	var sink = &Sink{
+		producer: producer,
+		config:   outputConfig,
+		key:      key,
+		headers:  headers,
+		source:   source,
+	}
+
+	sink.group.Add(2)
+	go sink.acknowledge()
+	go sink.fail()
+	return sink, nil
+}
+
+// Send produces the document of the given message. The message is acknowledged once the record has been written.
+func (s *Sink) Send(message *sarama.ConsumerMessage, document map[string]any) error {
+	var value, err = json.Marshal(document)
+	if err != nil {
+		return fmt.Errorf("could not encode document: %w", err)
+	}
+
+	var record = &sarama.ProducerMessage{
+		Topic:    s.config.Topic,
+		Value:    sarama.ByteEncoder(value),
+		Headers:  s.recordHeaders(message),
+		Metadata: message,
+	}
+
+	if key, err := s.key.Key(message, document); err == nil {
+		record.Key = sarama.StringEncoder(key)
+	} else {
+		log.Debug().Fields(utils.GetFieldsFromMessage(message)).Err(err).Msg("Producing document without key")
+	}
+
+	s.producer.Input() <- record
+	return nil
+}
+
+func (s *Sink) recordHeaders(message *sarama.ConsumerMessage) []sarama.RecordHeader {
+	var headers = make([]sarama.RecordHeader, 0, len(message.Headers)+len(s.headers))
+	if s.config.ForwardHeaders {
+		for _, header := range message.Headers {
+			headers = append(headers, sarama.RecordHeader{Key: slices.Clone(header.Key), Value: slices.Clone(header.Value)})
+		}
+	}
+	return append(headers, s.headers...)
+}
+
+func (s *Sink) acknowledge() {
+	defer s.group.Done()
+	for record := range s.producer.Successes() {
+		s.source.Acknowledge(record.Metadata.(*sarama.ConsumerMessage))
+		metrics.RecordProduced(record.Topic)
+
+		// commit once per batch of records instead of once per record
+		if len(s.producer.Successes()) == 0 {
+			s.source.CommitOffsets()
+		}
+	}
+}
+
+func (s *Sink) fail() {
+	defer s.group.Done()
+	for err := range s.producer.Errors() {
+		var message = err.Msg.Metadata.(*sarama.ConsumerMessage)
+		log.Fatal().Fields(utils.GetFieldsFromMessage(message)).Err(err.Err).Str("topic", s.config.Topic).Msg("Could not produce document")
+	}
+}
+
+// Close waits for all pending records to be written.
+func (s *Sink) Close() {
+	s.producer.AsyncClose()
+	s.group.Wait()
+}
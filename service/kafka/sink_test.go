@@ -0,0 +1,27 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package kafka_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"vortex/service/config"
+	"vortex/service/kafka"
+)
+
+func TestNewSink_Invalid(t *testing.T) {
+	var cases = map[string]config.Output{
+		"missing topic":  {Key: []config.IdentityComponent{{Source: "key"}}},
+		"invalid key":    {Topic: "status-out", Key: []config.IdentityComponent{{Source: "body"}}},
+		"unnamed header": {Topic: "status-out", Headers: []config.OutputHeader{{Value: "vortex"}}},
+	}
+
+	for name, outputConfig := range cases {
+		t.Run(name, func(t *testing.T) {
+			var _, err = kafka.NewSink(&outputConfig, &config.Kafka{}, nil)
+			assert.NotNil(t, err, "expected an error")
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package kafka
+
+import (
+	"github.com/IBM/sarama"
+	"sync"
+)
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+type partitionOffsets struct {
+	pending      []*sarama.ConsumerMessage
+	acknowledged map[int64]int
+	required     map[int64]int
+}
+
+// OffsetTracker keeps track of consumed messages per partition and determines up to which message
+// everything has been acknowledged, so that offsets are never committed ahead of pending writes.
+type OffsetTracker struct {
+	partitions map[topicPartition]*partitionOffsets
+	mutex      sync.Mutex
+}
+
+func NewOffsetTracker() *OffsetTracker {
+	return &OffsetTracker{
+		partitions: make(map[topicPartition]*partitionOffsets),
+	}
+}
+
+func (t *OffsetTracker) Track(message *sarama.ConsumerMessage) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var key = topicPartition{message.Topic, message.Partition}
+	var offsets, ok = t.partitions[key]
+	if !ok {
+		offsets = &partitionOffsets{acknowledged: make(map[int64]int), required: make(map[int64]int)}
+		t.partitions[key] = offsets
+	}
+	offsets.pending = append(offsets.pending, message)
+}
+
+// Expect requires the given message to be acknowledged the given amount of times before it counts as processed
+// (e.g. once per sink it is written to). It has to be called before the message is acknowledged for the first time.
+func (t *OffsetTracker) Expect(message *sarama.ConsumerMessage, acknowledgements int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if offsets, ok := t.partitions[topicPartition{message.Topic, message.Partition}]; ok {
+		offsets.required[message.Offset] = acknowledgements
+	}
+}
+
+// Acknowledge marks the given messages as processed and returns the last message of every partition
+// whose offset may be committed now. Messages that are not tracked (e.g. from a previous generation) are ignored.
+func (t *OffsetTracker) Acknowledge(messages ...*sarama.ConsumerMessage) []*sarama.ConsumerMessage {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var touched = make(map[topicPartition]bool)
+	for _, message := range messages {
+		var key = topicPartition{message.Topic, message.Partition}
+		if offsets, ok := t.partitions[key]; ok {
+			offsets.acknowledged[message.Offset]++
+			touched[key] = true
+		}
+	}
+
+	var committable = make([]*sarama.ConsumerMessage, 0, len(touched))
+	for key := range touched {
+		var offsets = t.partitions[key]
+		var last *sarama.ConsumerMessage
+		for len(offsets.pending) > 0 && offsets.isAcknowledged(offsets.pending[0].Offset) {
+			last = offsets.pending[0]
+			delete(offsets.acknowledged, last.Offset)
+			delete(offsets.required, last.Offset)
+			offsets.pending = offsets.pending[1:]
+		}
+
+		if last != nil {
+			committable = append(committable, last)
+		}
+	}
+	return committable
+}
+
+func (o *partitionOffsets) isAcknowledged(offset int64) bool {
+	var required, ok = o.required[offset]
+	if !ok {
+		required = 1
+	}
+	return o.acknowledged[offset] >= required
+}
+
+// Reset forgets all tracked messages, which is required whenever partitions are re-assigned.
+func (t *OffsetTracker) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.partitions = make(map[topicPartition]*partitionOffsets)
+}
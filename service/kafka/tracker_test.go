@@ -0,0 +1,66 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package kafka_test
+
+import (
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"vortex/service/kafka"
+)
+
+func TestOffsetTracker_Acknowledge(t *testing.T) {
+	var assertions = assert.New(t)
+	var tracker = kafka.NewOffsetTracker()
+
+	var messages = []*sarama.ConsumerMessage{
+		{Topic: "status", Partition: 0, Offset: 10},
+		{Topic: "status", Partition: 0, Offset: 11},
+		{Topic: "status", Partition: 0, Offset: 13},
+		{Topic: "status", Partition: 1, Offset: 5},
+	}
+	for _, message := range messages {
+		tracker.Track(message)
+	}
+
+	var committable = tracker.Acknowledge(messages[1], messages[3])
+	assertions.Equal([]*sarama.ConsumerMessage{messages[3]}, committable, "expected only partition 1 to be committable")
+
+	committable = tracker.Acknowledge(messages[0])
+	assertions.Equal([]*sarama.ConsumerMessage{messages[1]}, committable, "expected offset 11 to be committable")
+
+	committable = tracker.Acknowledge(messages[2])
+	assertions.Equal([]*sarama.ConsumerMessage{messages[2]}, committable, "expected offset 13 to be committable")
+}
+
+func TestOffsetTracker_Expect(t *testing.T) {
+	var assertions = assert.New(t)
+	var tracker = kafka.NewOffsetTracker()
+
+	var messages = []*sarama.ConsumerMessage{
+		{Topic: "status", Partition: 0, Offset: 1},
+		{Topic: "status", Partition: 0, Offset: 2},
+	}
+	for _, message := range messages {
+		tracker.Track(message)
+	}
+	tracker.Expect(messages[0], 2)
+
+	assertions.Empty(tracker.Acknowledge(messages[0], messages[1]), "expected offset 1 to require a second acknowledgement")
+
+	var committable = tracker.Acknowledge(messages[0])
+	assertions.Equal([]*sarama.ConsumerMessage{messages[1]}, committable, "expected offset 2 to be committable")
+}
+
+func TestOffsetTracker_Reset(t *testing.T) {
+	var assertions = assert.New(t)
+	var tracker = kafka.NewOffsetTracker()
+	var message = &sarama.ConsumerMessage{Topic: "status", Partition: 0, Offset: 1}
+
+	tracker.Track(message)
+	tracker.Reset()
+
+	assertions.Empty(tracker.Acknowledge(message), "expected untracked messages to be ignored")
+}
@@ -27,6 +27,23 @@ var (
 
 	upsertedTotal prometheus.Counter
 
+	bulkWriteDuration prometheus.Histogram
+	bulkSize          prometheus.Gauge
+
+	coalescedTotal  prometheus.Counter
+	coalescingRatio prometheus.Gauge
+
+	filteredTotal *prometheus.CounterVec
+	invalidTotal  *prometheus.CounterVec
+
+	transformInvocationsTotal *prometheus.CounterVec
+	transformErrorsTotal      *prometheus.CounterVec
+	transformDuration         *prometheus.HistogramVec
+
+	typedDecodingFallbackTotal prometheus.Counter
+
+	producedTotal *prometheus.CounterVec
+
 	registry *prometheus.Registry
 
 	enabled *bool
@@ -41,6 +58,29 @@ func init() {
 
 	upsertedTotal = createCounter("upserted_total", "The total amount of upserted datasets")
 	registry.MustRegister(upsertedTotal)
+
+	bulkWriteDuration = createHistogram("bulk_write_duration_seconds", "The duration of bulk-writes to the database")
+	bulkSize = createGauge("bulk_size", "The current amount of documents that triggers a bulk-write")
+	registry.MustRegister(bulkWriteDuration, bulkSize)
+
+	coalescedTotal = createCounter("coalesced_total", "The total amount of updates merged into other updates of the same bulk")
+	coalescingRatio = createGauge("coalescing_ratio", "The amount of consumed messages per written update of the last bulk")
+	registry.MustRegister(coalescedTotal, coalescingRatio)
+
+	filteredTotal = createCounterVec("filtered_total", "The total amount of messages dropped by filters", "rule")
+	invalidTotal = createCounterVec("invalid_total", "The total amount of messages not matching their schema", "schema")
+	registry.MustRegister(filteredTotal, invalidTotal)
+
+	transformInvocationsTotal = createCounterVec("transform_invocations_total", "The total amount of applied transformations", "transform")
+	transformErrorsTotal = createCounterVec("transform_errors_total", "The total amount of failed transformations", "transform", "policy")
+	transformDuration = createHistogramVec("transform_duration_seconds", "The duration of transformations", "transform")
+	registry.MustRegister(transformInvocationsTotal, transformErrorsTotal, transformDuration)
+
+	typedDecodingFallbackTotal = createCounter("typed_decoding_fallback_total", "The total amount of messages decoded generically because typed decoding does not support them")
+	registry.MustRegister(typedDecodingFallbackTotal)
+
+	producedTotal = createCounterVec("produced_total", "The total amount of documents produced to output topics", "topic")
+	registry.MustRegister(producedTotal)
 }
 
 func RecordConsumption(message *sarama.ConsumerMessage) {
@@ -74,6 +114,65 @@ func RecordUpserts(datasetCount float64) {
 	upsertedTotal.Add(float64(datasetCount))
 }
 
+func RecordBulkWrite(duration time.Duration, currentBulkSize int) {
+	if !isEnabled() {
+		return
+	}
+	bulkWriteDuration.Observe(duration.Seconds())
+	bulkSize.Set(float64(currentBulkSize))
+}
+
+func RecordCoalescing(messageCount int, updateCount int, ratio float64) {
+	if !isEnabled() {
+		return
+	}
+	coalescedTotal.Add(float64(messageCount - updateCount))
+	coalescingRatio.Set(ratio)
+}
+
+func RecordFiltered(rule string) {
+	if !isEnabled() {
+		return
+	}
+	filteredTotal.WithLabelValues(rule).Inc()
+}
+
+func RecordInvalid(schema string) {
+	if !isEnabled() {
+		return
+	}
+	invalidTotal.WithLabelValues(schema).Inc()
+}
+
+func RecordTransform(transform string, duration time.Duration) {
+	if !isEnabled() {
+		return
+	}
+	transformInvocationsTotal.WithLabelValues(transform).Inc()
+	transformDuration.WithLabelValues(transform).Observe(duration.Seconds())
+}
+
+func RecordTransformError(transform string, policy string) {
+	if !isEnabled() {
+		return
+	}
+	transformErrorsTotal.WithLabelValues(transform, policy).Inc()
+}
+
+func RecordTypedDecodingFallback() {
+	if !isEnabled() {
+		return
+	}
+	typedDecodingFallbackTotal.Inc()
+}
+
+func RecordProduced(topic string) {
+	if !isEnabled() {
+		return
+	}
+	producedTotal.WithLabelValues(topic).Inc()
+}
+
 func ExposeMetrics() {
 	http.HandleFunc("/livez", healthHandler("livez"))
 	http.HandleFunc("/readyz", healthHandler("readyz"))
@@ -107,6 +206,40 @@ func createCounter(name string, help string) prometheus.Counter {
 	})
 }
 
+func createCounterVec(name string, help string, labels ...string) *prometheus.CounterVec {
+	return promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      name,
+		Help:      help,
+	}, labels)
+}
+
+func createGauge(name string, help string) prometheus.Gauge {
+	return promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      name,
+		Help:      help,
+	})
+}
+
+func createHistogram(name string, help string) prometheus.Histogram {
+	return promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      name,
+		Help:      help,
+		Buckets:   prometheus.DefBuckets,
+	})
+}
+
+func createHistogramVec(name string, help string, labels ...string) *prometheus.HistogramVec {
+	return promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      name,
+		Help:      help,
+		Buckets:   []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05, .1},
+	}, labels)
+}
+
 func isEnabled() bool {
 	if enabled == nil {
 		enabled = &config.Current.Metrics.Enabled
@@ -0,0 +1,335 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package mongo
+
+import (
+	"fmt"
+	"github.com/IBM/sarama"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/trace"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// bulkEntry is the upsert of a document. The completion, if any, is written right after it if the document is a
+// placeholder.
+type bulkEntry struct {
+	collection string
+	filter     bson.M
+	update     bson.M
+	completion bson.M
+}
+
+// key identifies the document the entry updates. Entries with the same key are coalesced and never written by two
+// bulk-writes at the same time.
+func (e *bulkEntry) key() string {
+	return fmt.Sprintf("%s/%v", e.collection, e.filter)
+}
+
+// bulk is a batch of updates handed off to a writer together with the messages it originates from.
+// If coalescing is enabled, updates sharing the same filter are merged into a single update.
+type bulk struct {
+	entries  []*bulkEntry
+	index    map[string]*bulkEntry
+	messages []*sarama.ConsumerMessage
+	spans    []trace.Span
+	keys     map[string]bool
+	bytes    int
+	coalesce bool
+}
+
+func newBulk(coalesce bool) *bulk {
+	return &bulk{
+		entries:  make([]*bulkEntry, 0),
+		index:    make(map[string]*bulkEntry),
+		messages: make([]*sarama.ConsumerMessage, 0),
+		spans:    make([]trace.Span, 0),
+		keys:     make(map[string]bool),
+		coalesce: coalesce,
+	}
+}
+
+func (b *bulk) add(entry *bulkEntry, message *sarama.ConsumerMessage, span trace.Span, size int) {
+	var key = entry.key()
+	b.messages = append(b.messages, message)
+	b.spans = append(b.spans, span)
+	b.keys[key] = true
+	b.bytes += size
+
+	if b.coalesce {
+		if existing, ok := b.index[key]; ok && MergeUpdates(existing.update, entry.update) {
+			existing.completion = mergeCompletions(existing.completion, entry.completion)
+			return
+		}
+		b.index[key] = entry
+	}
+
+	b.entries = append(b.entries, entry)
+}
+
+// models returns the write models of the bulk grouped by collection.
+func (b *bulk) models() map[string][]mongo.WriteModel {
+	var models = make(map[string][]mongo.WriteModel)
+	for _, entry := range b.entries {
+		var model = mongo.NewUpdateOneModel().SetFilter(entry.filter).SetUpdate(entry.update).SetUpsert(true)
+		models[entry.collection] = append(models[entry.collection], model)
+
+		if entry.completion != nil {
+			var filter = maps.Clone(entry.filter)
+			filter[placeholderField] = true
+			models[entry.collection] = append(models[entry.collection], mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(entry.completion))
+		}
+	}
+	return models
+}
+
+// persisted ends the spans of all messages of the bulk.
+func (b *bulk) persisted() {
+	for _, span := range b.spans {
+		span.AddEvent("persisted")
+		span.End()
+	}
+}
+
+func (b *bulk) len() int {
+	return len(b.entries)
+}
+
+// coalescingRatio returns the amount of consumed messages per written update.
+func (b *bulk) coalescingRatio() float64 {
+	if len(b.entries) == 0 {
+		return 1
+	}
+	return float64(len(b.messages)) / float64(len(b.entries))
+}
+
+// MergeUpdates merges the operators of source into target, with later values winning. Increments are summed up and
+// the greater or lesser value of $max and $min is kept. Fields written on insert are only kept from target, since the
+// document already exists once source is applied, and are dropped if they are set by either update.
+// It returns false without modifying target if one of the operators or values cannot be merged.
+func MergeUpdates(target bson.M, source bson.M) bool {
+	for _, update := range []bson.M{target, source} {
+		for operator, fields := range update {
+			if _, ok := asMap(fields); !ok || (operator != "$setOnInsert" && !slices.Contains(mergedOperators, operator)) {
+				return false
+			}
+		}
+	}
+
+	var merged = make(map[string]map[string]any)
+	for _, operator := range mergedOperators {
+		var sourceFields, _ = asMap(source[operator])
+		var targetFields, _ = asMap(target[operator])
+		if len(sourceFields) == 0 {
+			continue
+		}
+
+		merged[operator] = make(map[string]any, len(sourceFields))
+		for field, value := range sourceFields {
+			if existing, ok := targetFields[field]; ok && operator != "$set" {
+				if value, ok = combine(operator, existing, value); !ok {
+					return false
+				}
+			}
+			merged[operator][field] = value
+		}
+	}
+
+	for operator, fields := range merged {
+		var targetFields, ok = asMap(target[operator])
+		if !ok {
+			targetFields = make(map[string]any, len(fields))
+		}
+		target[operator] = targetFields
+
+		for field, value := range fields {
+			targetFields[field] = value
+		}
+	}
+
+	if insertFields, ok := asMap(target["$setOnInsert"]); ok {
+		var setFields, _ = asMap(target["$set"])
+		for field := range setFields {
+			delete(insertFields, field)
+		}
+
+		if len(insertFields) > 0 {
+			target["$setOnInsert"] = insertFields
+		} else {
+			delete(target, "$setOnInsert")
+		}
+	}
+	return true
+}
+
+// mergeCompletions merges the completion of a coalesced update into the existing one. Like fields written on insert,
+// fields of the existing completion are kept.
+func mergeCompletions(existing bson.M, completion bson.M) bson.M {
+	if existing == nil {
+		return completion
+	} else if completion == nil {
+		return existing
+	}
+
+	var fields, _ = completion["$set"].(bson.M)
+	for field, value := range fields {
+		var existingFields, ok = existing["$set"].(bson.M)
+		if !ok {
+			existingFields = make(bson.M, len(fields))
+			existing["$set"] = existingFields
+		}
+		if _, ok := existingFields[field]; !ok {
+			existingFields[field] = value
+		}
+	}
+	return existing
+}
+
+// mergedOperators are the operators whose fields MergeUpdates combines. $setOnInsert is only kept from the target.
+var mergedOperators = []string{"$set", "$inc", "$max", "$min"}
+
+// combine returns the value of applying the operator with current and value in sequence.
+func combine(operator string, current any, value any) (any, bool) {
+	if currentTime, ok := current.(time.Time); ok {
+		var valueTime, ok = value.(time.Time)
+		if !ok || operator == "$inc" {
+			return nil, false
+		}
+
+		if (operator == "$max") == valueTime.After(currentTime) {
+			return valueTime, true
+		}
+		return currentTime, true
+	}
+
+	var currentInt, currentIsInt = toInt64(current)
+	var valueInt, valueIsInt = toInt64(value)
+	var currentFloat, currentIsNumber = toFloat64(current)
+	var valueFloat, valueIsNumber = toFloat64(value)
+	if !currentIsNumber || !valueIsNumber {
+		return nil, false
+	}
+
+	switch operator {
+
+	case "$inc":
+		if currentIsInt && valueIsInt {
+			return currentInt + valueInt, true
+		}
+		return currentFloat + valueFloat, true
+
+	case "$max":
+		if valueFloat > currentFloat {
+			return value, true
+		}
+		return current, true
+
+	default:
+		if valueFloat < currentFloat {
+			return value, true
+		}
+		return current, true
+
+	}
+}
+
+func toInt64(value any) (int64, bool) {
+	switch casted := value.(type) {
+	case int:
+		return int64(casted), true
+	case int32:
+		return int64(casted), true
+	case int64:
+		return casted, true
+	default:
+		return 0, false
+	}
+}
+
+func toFloat64(value any) (float64, bool) {
+	if casted, ok := toInt64(value); ok {
+		return float64(casted), true
+	}
+
+	switch casted := value.(type) {
+	case float32:
+		return float64(casted), true
+	case float64:
+		return casted, true
+	default:
+		return 0, false
+	}
+}
+
+func asMap(value any) (map[string]any, bool) {
+	switch casted := value.(type) {
+
+	case map[string]any:
+		return casted, true
+
+	case bson.M:
+		return casted, true
+
+	case bson.D:
+		var converted = make(map[string]any, len(casted))
+		for _, element := range casted {
+			converted[element.Key] = element.Value
+		}
+		return converted, true
+
+	default:
+		return nil, false
+
+	}
+}
+
+// keyLock guarantees that documents sharing the same key are never part of two concurrent bulk-writes.
+type keyLock struct {
+	inFlight map[string]bool
+	mutex    sync.Mutex
+	released *sync.Cond
+}
+
+func newKeyLock() *keyLock {
+	var lock = &keyLock{inFlight: make(map[string]bool)}
+	lock.released = sync.NewCond(&lock.mutex)
+	return lock
+}
+
+// acquire blocks until none of the given keys is part of a bulk-write in flight and claims them afterward.
+func (l *keyLock) acquire(keys map[string]bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for l.conflicts(keys) {
+		l.released.Wait()
+	}
+
+	for key := range keys {
+		l.inFlight[key] = true
+	}
+}
+
+func (l *keyLock) release(keys map[string]bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for key := range keys {
+		delete(l.inFlight, key)
+	}
+	l.released.Broadcast()
+}
+
+func (l *keyLock) conflicts(keys map[string]bool) bool {
+	for key := range keys {
+		if l.inFlight[key] {
+			return true
+		}
+	}
+	return false
+}
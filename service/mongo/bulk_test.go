@@ -0,0 +1,169 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package mongo_test
+
+import (
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+	"time"
+	"vortex/service/config"
+	"vortex/service/identity"
+	"vortex/service/mongo"
+)
+
+func TestMergeUpdates(t *testing.T) {
+	var assertions = assert.New(t)
+	var target = bson.M{"$set": map[string]any{"status": "PROCESSED", "event.id": "1"}}
+	var source = bson.M{"$set": map[string]any{"status": "DELIVERED", "deliveryType": "CALLBACK"}}
+
+	assertions.True(mongo.MergeUpdates(target, source), "expected updates to be merged")
+
+	var expected = bson.M{"$set": map[string]any{
+		"status":       "DELIVERED",
+		"event.id":     "1",
+		"deliveryType": "CALLBACK",
+	}}
+	assertions.Equal(expected, target, "expected later fields to win")
+}
+
+func TestMergeUpdates_UnsupportedOperator(t *testing.T) {
+	var assertions = assert.New(t)
+	var target = bson.M{"$set": map[string]any{"status": "PROCESSED"}}
+	var source = bson.M{"$unset": map[string]any{"status": ""}}
+
+	assertions.False(mongo.MergeUpdates(target, source), "expected updates to not be merged")
+	assertions.Equal(bson.M{"$set": map[string]any{"status": "PROCESSED"}}, target, "expected target to be unchanged")
+}
+
+func TestMergeUpdates_OrderedDocuments(t *testing.T) {
+	var assertions = assert.New(t)
+	var target = bson.M{"$set": bson.D{{Key: "status", Value: "PROCESSED"}, {Key: "event.id", Value: "1"}}}
+	var source = bson.M{"$set": bson.D{{Key: "status", Value: "DELIVERED"}}}
+
+	assertions.True(mongo.MergeUpdates(target, source), "expected updates to be merged")
+	assertions.Equal(bson.M{"$set": map[string]any{"status": "DELIVERED", "event.id": "1"}}, target, "expected later fields to win")
+}
+
+func TestMergeUpdates_SetOnInsert(t *testing.T) {
+	var assertions = assert.New(t)
+	var target = bson.M{
+		"$set":         map[string]any{"status": "DROPPED"},
+		"$setOnInsert": map[string]any{"event.type": "vortex.test.event", "subscriptionId": "1"},
+	}
+	var source = bson.M{
+		"$set":         map[string]any{"status": "DELIVERED", "subscriptionId": "2"},
+		"$setOnInsert": map[string]any{"deliveryType": "CALLBACK"},
+	}
+
+	assertions.True(mongo.MergeUpdates(target, source), "expected updates to be merged")
+	assertions.Equal(bson.M{
+		"$set":         map[string]any{"status": "DELIVERED", "subscriptionId": "2"},
+		"$setOnInsert": map[string]any{"event.type": "vortex.test.event"},
+	}, target, "expected only fields of the first update that are never set to be written on insert")
+}
+
+func TestMergeUpdates_Operators(t *testing.T) {
+	var assertions = assert.New(t)
+	var first, second = time.Unix(1, 0), time.Unix(2, 0)
+	var target = bson.M{
+		"$inc": map[string]any{"retries": 1},
+		"$max": map[string]any{"lastSeen": first, "attempt": 3},
+		"$min": map[string]any{"firstSeen": first},
+	}
+	var source = bson.M{
+		"$inc": map[string]any{"retries": int64(2), "ratio": 0.5},
+		"$max": map[string]any{"lastSeen": second, "attempt": 2.5},
+		"$min": map[string]any{"firstSeen": second},
+	}
+
+	assertions.True(mongo.MergeUpdates(target, source), "expected updates to be merged")
+	assertions.Equal(bson.M{
+		"$inc": map[string]any{"retries": int64(3), "ratio": 0.5},
+		"$max": map[string]any{"lastSeen": second, "attempt": 3},
+		"$min": map[string]any{"firstSeen": first},
+	}, target)
+
+	var incompatible = bson.M{"$max": map[string]any{"lastSeen": "yesterday"}}
+	assertions.False(mongo.MergeUpdates(target, incompatible), "expected values of different types to not be merged")
+	assertions.Equal(second, target["$max"].(map[string]any)["lastSeen"], "expected target to be unchanged")
+}
+
+func TestBulkKeys(t *testing.T) {
+	var assertions = assert.New(t)
+	var eventId = false
+	var id, err = identity.New(&config.Identity{
+		Components: []config.IdentityComponent{{Source: identity.SourcePath, Path: "subscriptionId"}},
+		EventId:    &eventId,
+	}, nil)
+	assertions.Nil(err, "expected no error")
+
+	var messages = []*sarama.ConsumerMessage{{Key: []byte("first")}, {Key: []byte("second")}, {Key: []byte("third")}}
+	var filters = make([]bson.M, len(messages))
+	for i, message := range messages {
+		filters[i], err = id.Filter(message, map[string]any{"subscriptionId": "0df6658d"})
+		assertions.Nil(err, "expected no error")
+	}
+
+	var keys = mongo.BulkKeys(messages, []string{"status", "status", "callbacks"}, filters)
+	assertions.Len(keys, 2, "expected messages with different keys but the same document to share a key per collection")
+}
+
+func TestKeyLock(t *testing.T) {
+	var assertions = assert.New(t)
+	var lock = mongo.NewKeyLock()
+	lock.Acquire("a", "b")
+
+	var acquired = make(chan string, 2)
+	go func() {
+		lock.Acquire("c", "d")
+		acquired <- "disjoint"
+	}()
+	go func() {
+		lock.Acquire("b", "e")
+		acquired <- "overlapping"
+	}()
+
+	select {
+	case name := <-acquired:
+		assertions.Equal("disjoint", name, "expected bulks without common keys to proceed")
+	case <-time.After(time.Second):
+		t.Fatal("expected bulks without common keys to proceed")
+	}
+
+	select {
+	case <-acquired:
+		t.Fatal("expected the bulk with a common key to wait for the first one")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	lock.Release("a", "b")
+	select {
+	case name := <-acquired:
+		assertions.Equal("overlapping", name)
+	case <-time.After(time.Second):
+		t.Fatal("expected the bulk with a common key to proceed after the first one was released")
+	}
+}
+
+func BenchmarkBuildModels(b *testing.B) {
+	var filters = make([]bson.M, 500)
+	var updates = make([]bson.M, 500)
+	for i := range filters {
+		filters[i] = bson.M{"_id": fmt.Sprintf("key-%d", i%250), "event.id": fmt.Sprintf("event-%d", i%250)}
+		updates[i] = bson.M{"$set": map[string]any{"status": "DELIVERED", "event.type": "vortex.test.event", "modified": i}}
+	}
+
+	for _, coalesce := range []bool{false, true} {
+		b.Run(fmt.Sprintf("coalesce=%t", coalesce), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				mongo.BuildModels(coalesce, "status", filters, updates)
+			}
+		})
+	}
+}
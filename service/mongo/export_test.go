@@ -0,0 +1,110 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package mongo
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+	"vortex/service/config"
+	"vortex/service/identity"
+)
+
+// BuildModels buffers the given updates of the default collection and returns their write models, which exposes
+// the bulk to benchmarks.
+func BuildModels(coalesce bool, collection string, filters []bson.M, updates []bson.M) map[string][]mongo.WriteModel {
+	var buffer = newBulk(coalesce)
+	var span = trace.SpanFromContext(context.Background())
+	for i := range filters {
+		var message = &sarama.ConsumerMessage{Key: []byte(filters[i]["_id"].(string))}
+		buffer.add(&bulkEntry{collection, filters[i], updates[i], nil}, message, span, 0)
+	}
+	return buffer.models()
+}
+
+// BulkKeys buffers updates of the given filters and collections and returns the keys locked while writing them.
+func BulkKeys(messages []*sarama.ConsumerMessage, collections []string, filters []bson.M) map[string]bool {
+	var buffer = newBulk(false)
+	var span = trace.SpanFromContext(context.Background())
+	for i := range filters {
+		buffer.add(&bulkEntry{collections[i], filters[i], bson.M{"$set": bson.M{}}, nil}, messages[i], span, 0)
+	}
+	return buffer.keys
+}
+
+// BuildUpdate returns the update of a document of the given message type.
+func BuildUpdate(mongoConfig *config.Mongo, messageType string, document map[string]any) (bson.M, error) {
+	var builders, err = newUpdateBuilders(mongoConfig)
+	if err != nil {
+		return nil, err
+	}
+	return builders.build(messageType, document), nil
+}
+
+// ExpiryAt returns the expiry of a document with the given retention class and status.
+func ExpiryAt(retention *config.MongoRetention, class string, status string) (time.Time, bool) {
+	return newExpiry(retention).at(class, status)
+}
+
+// SetExpiry sets the expiry of the document as configured and returns the expiry that is only written on insert.
+func SetExpiry(retention *config.MongoRetention, document map[string]any) time.Time {
+	return setExpiry(newExpiry(retention), retention.Field, document)
+}
+
+// KeyLock exposes the lock of documents in flight to tests.
+type KeyLock struct {
+	lock *keyLock
+}
+
+func NewKeyLock() *KeyLock {
+	return &KeyLock{lock: newKeyLock()}
+}
+
+func (l *KeyLock) Acquire(keys ...string) {
+	l.lock.acquire(toKeys(keys))
+}
+
+func (l *KeyLock) Release(keys ...string) {
+	l.lock.release(toKeys(keys))
+}
+
+func toKeys(keys []string) map[string]bool {
+	var set = make(map[string]bool, len(keys))
+	for _, key := range keys {
+		set[key] = true
+	}
+	return set
+}
+
+// BulkWriteFunc replaces the database in tests.
+type BulkWriteFunc = bulkWriter
+
+// NewBufferedConnection creates a connection without database, which writes its bulks with the given function.
+func NewBufferedConnection(mongoConfig *config.Mongo, source Source, write BulkWriteFunc, outputs ...Output) (*Connection, error) {
+	var identities, err = identity.NewRoutes(&mongoConfig.Identity, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	connection, err := NewConnection(mongoConfig, source, nil, nil, identities, outputs...)
+	if err != nil {
+		return nil, err
+	}
+	connection.writeBulk = write
+	return connection, nil
+}
+
+// Upsert transforms the given message and buffers the update of its document.
+func (c *Connection) Upsert(message *sarama.ConsumerMessage) error {
+	return c.upsert(message)
+}
+
+// Enqueue buffers an update of the given document like an upsert.
+func (c *Connection) Enqueue(message *sarama.ConsumerMessage, filter bson.M, update bson.M) {
+	c.enqueue(message, trace.SpanFromContext(context.Background()), &bulkEntry{c.config.Collection, filter, update, nil})
+}
@@ -0,0 +1,319 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+	"slices"
+	"strings"
+	"vortex/service/config"
+	"vortex/service/filter"
+)
+
+// ExistingIndex is an index as reported by the database.
+type ExistingIndex struct {
+	Name                    string `bson:"name"`
+	Key                     bson.D `bson:"key"`
+	Unique                  bool   `bson:"unique"`
+	PartialFilterExpression bson.M `bson:"partialFilterExpression"`
+	ExpireAfterSeconds      *int32 `bson:"expireAfterSeconds"`
+}
+
+// IndexDiff describes the difference between the configured and the existing indexes of a collection.
+// Indexes are matched by name, which defaults to the name MongoDB generates from the keys.
+type IndexDiff struct {
+	Missing   []config.MongoIndex
+	Changed   []config.MongoIndex
+	Unchanged []string
+	Unmanaged []string
+}
+
+func (d *IndexDiff) String() string {
+	var builder = strings.Builder{}
+	for _, index := range d.Missing {
+		builder.WriteString(fmt.Sprintf("+ %s %s\n", IndexName(index), describeIndex(index)))
+	}
+	for _, index := range d.Changed {
+		builder.WriteString(fmt.Sprintf("~ %s %s\n", IndexName(index), describeIndex(index)))
+	}
+	for _, name := range d.Unchanged {
+		builder.WriteString(fmt.Sprintf("= %s\n", name))
+	}
+	for _, name := range d.Unmanaged {
+		builder.WriteString(fmt.Sprintf("? %s (not configured)\n", name))
+	}
+	return builder.String()
+}
+
+// Collections returns the default collection followed by all collections the filter routes messages to, which all
+// share the same indexes.
+func Collections(mongoConfig *config.Mongo, messageFilter *filter.Filter) []string {
+	var collections = []string{mongoConfig.Collection}
+	for _, collection := range messageFilter.Collections() {
+		if !slices.Contains(collections, collection) {
+			collections = append(collections, collection)
+		}
+	}
+	return collections
+}
+
+type IndexManager struct {
+	collection *mongo.Collection
+	desired    []config.MongoIndex
+}
+
+func NewIndexManager(collection *mongo.Collection, desired []config.MongoIndex) *IndexManager {
+	return &IndexManager{collection, desired}
+}
+
+func (m *IndexManager) Diff(ctx context.Context) (*IndexDiff, error) {
+	cursor, err := m.collection.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing = make([]ExistingIndex, 0)
+	if err := cursor.All(ctx, &existing); err != nil {
+		return nil, err
+	}
+
+	return DiffIndexes(m.desired, existing)
+}
+
+// Reconcile creates all missing indexes. Changed indexes are never dropped automatically,
+// since rebuilding an index on a large collection has to be planned.
+func (m *IndexManager) Reconcile(ctx context.Context) (*IndexDiff, error) {
+	var diff, err = m.Diff(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(diff.Missing) == 0 {
+		return diff, nil
+	}
+
+	var models = make([]mongo.IndexModel, len(diff.Missing))
+	for i, index := range diff.Missing {
+		if models[i], err = indexModel(index); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := m.collection.Indexes().CreateMany(ctx, models); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+func DiffIndexes(desired []config.MongoIndex, existing []ExistingIndex) (*IndexDiff, error) {
+	var diff = &IndexDiff{
+		Missing:   make([]config.MongoIndex, 0),
+		Changed:   make([]config.MongoIndex, 0),
+		Unchanged: make([]string, 0),
+		Unmanaged: make([]string, 0),
+	}
+
+	var existingByName = make(map[string]ExistingIndex)
+	for _, index := range existing {
+		existingByName[index.Name] = index
+	}
+
+	var managed = make(map[string]bool)
+	for _, index := range desired {
+		var name = IndexName(index)
+		managed[name] = true
+
+		partialFilter, err := parsePartialFilter(index)
+		if err != nil {
+			return nil, err
+		}
+
+		current, ok := existingByName[name]
+		switch {
+
+		case !ok:
+			diff.Missing = append(diff.Missing, index)
+
+		case !indexMatches(index, partialFilter, current):
+			diff.Changed = append(diff.Changed, index)
+
+		default:
+			diff.Unchanged = append(diff.Unchanged, name)
+
+		}
+	}
+
+	for _, index := range existing {
+		if !managed[index.Name] && index.Name != "_id_" {
+			diff.Unmanaged = append(diff.Unmanaged, index.Name)
+		}
+	}
+
+	return diff, nil
+}
+
+// IndexName returns the configured name of an index or the name MongoDB would generate for its keys.
+func IndexName(index config.MongoIndex) string {
+	if len(index.Name) > 0 {
+		return index.Name
+	}
+
+	var parts = make([]string, 0, len(index.Keys)*2)
+	for _, key := range index.Keys {
+		parts = append(parts, key.Field, fmt.Sprintf("%d", keyOrder(key)))
+	}
+	return strings.Join(parts, "_")
+}
+
+func indexModel(index config.MongoIndex) (mongo.IndexModel, error) {
+	var partialFilter, err = parsePartialFilter(index)
+	if err != nil {
+		return mongo.IndexModel{}, err
+	}
+
+	var opts = options.Index().SetName(IndexName(index)).SetUnique(index.Unique)
+	if partialFilter != nil {
+		opts.SetPartialFilterExpression(partialFilter)
+	}
+	if index.ExpireAfterSeconds != nil {
+		opts.SetExpireAfterSeconds(*index.ExpireAfterSeconds)
+	}
+
+	return mongo.IndexModel{
+		Keys:    indexKeys(index),
+		Options: opts,
+	}, nil
+}
+
+// parsePartialFilter parses the partial filter expression of an index, which is configured as (extended) JSON
+// because the configuration would otherwise lower-case its field names.
+func parsePartialFilter(index config.MongoIndex) (bson.M, error) {
+	if len(index.PartialFilter) == 0 {
+		return nil, nil
+	}
+
+	var partialFilter bson.M
+	if err := bson.UnmarshalExtJSON([]byte(index.PartialFilter), false, &partialFilter); err != nil {
+		return nil, fmt.Errorf("invalid partial filter of index '%s': %w", IndexName(index), err)
+	}
+	return partialFilter, nil
+}
+
+func indexKeys(index config.MongoIndex) bson.D {
+	var keys = make(bson.D, len(index.Keys))
+	for i, key := range index.Keys {
+		keys[i] = bson.E{Key: key.Field, Value: keyOrder(key)}
+	}
+	return keys
+}
+
+func indexMatches(desired config.MongoIndex, partialFilter bson.M, existing ExistingIndex) bool {
+	if desired.Unique != existing.Unique {
+		return false
+	}
+
+	if (desired.ExpireAfterSeconds == nil) != (existing.ExpireAfterSeconds == nil) {
+		return false
+	}
+	if desired.ExpireAfterSeconds != nil && *desired.ExpireAfterSeconds != *existing.ExpireAfterSeconds {
+		return false
+	}
+
+	var desiredKeys = indexKeys(desired)
+	if len(desiredKeys) != len(existing.Key) {
+		return false
+	}
+	for i, key := range desiredKeys {
+		if key.Key != existing.Key[i].Key || !reflect.DeepEqual(normalize(key.Value), normalize(existing.Key[i].Value)) {
+			return false
+		}
+	}
+
+	if len(partialFilter) == 0 && len(existing.PartialFilterExpression) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(normalize(partialFilter), normalize(existing.PartialFilterExpression))
+}
+
+func describeIndex(index config.MongoIndex) string {
+	var keys = make([]string, len(index.Keys))
+	for i, key := range index.Keys {
+		keys[i] = fmt.Sprintf("%s:%d", key.Field, keyOrder(key))
+	}
+
+	var properties = []string{fmt.Sprintf("keys=[%s]", strings.Join(keys, " "))}
+	if index.Unique {
+		properties = append(properties, "unique")
+	}
+	if len(index.PartialFilter) > 0 {
+		properties = append(properties, fmt.Sprintf("partialFilter=%s", index.PartialFilter))
+	}
+	if index.ExpireAfterSeconds != nil {
+		properties = append(properties, fmt.Sprintf("expireAfterSeconds=%d", *index.ExpireAfterSeconds))
+	}
+	return strings.Join(properties, " ")
+}
+
+func keyOrder(key config.MongoIndexKey) int {
+	if key.Order == 0 {
+		return 1
+	}
+	return key.Order
+}
+
+// normalize converts numbers to float64 and documents to plain maps, so that values read from the
+// configuration can be compared with values decoded from the database.
+func normalize(value any) any {
+	switch casted := value.(type) {
+
+	case int:
+		return float64(casted)
+
+	case int32:
+		return float64(casted)
+
+	case int64:
+		return float64(casted)
+
+	case float32:
+		return float64(casted)
+
+	case bson.D:
+		var normalized = make(map[string]any, len(casted))
+		for _, element := range casted {
+			normalized[element.Key] = normalize(element.Value)
+		}
+		return normalized
+
+	case bson.M:
+		return normalize(map[string]any(casted))
+
+	case map[string]any:
+		var normalized = make(map[string]any, len(casted))
+		for k, v := range casted {
+			normalized[k] = normalize(v)
+		}
+		return normalized
+
+	case bson.A:
+		return normalize([]any(casted))
+
+	case []any:
+		var normalized = make([]any, len(casted))
+		for i, v := range casted {
+			normalized[i] = normalize(v)
+		}
+		return normalized
+
+	default:
+		return value
+
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package mongo_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+	"vortex/service/config"
+	"vortex/service/filter"
+	"vortex/service/mongo"
+)
+
+func TestDiffIndexes(t *testing.T) {
+	var assertions = assert.New(t)
+	var expireAfterSeconds = int32(0)
+	var desired = []config.MongoIndex{
+		{Keys: []config.MongoIndexKey{{Field: "event.id"}}},
+		{Keys: []config.MongoIndexKey{{Field: "subscriptionId"}, {Field: "modified", Order: -1}}},
+		{
+			Name:               "expiry",
+			Keys:               []config.MongoIndexKey{{Field: "expireAt"}},
+			PartialFilter:      `{"status": {"$exists": true}}`,
+			ExpireAfterSeconds: &expireAfterSeconds,
+		},
+	}
+	var existing = []mongo.ExistingIndex{
+		{Name: "_id_", Key: bson.D{{Key: "_id", Value: int32(1)}}},
+		{Name: "event.id_1", Key: bson.D{{Key: "event.id", Value: int32(1)}}},
+		{
+			Name:                    "expiry",
+			Key:                     bson.D{{Key: "expireAt", Value: int32(1)}},
+			PartialFilterExpression: bson.M{"status": bson.D{{Key: "$exists", Value: false}}},
+			ExpireAfterSeconds:      &expireAfterSeconds,
+		},
+		{Name: "status_1", Key: bson.D{{Key: "status", Value: int32(1)}}},
+	}
+
+	diff, err := mongo.DiffIndexes(desired, existing)
+	assertions.Nil(err, "expected no error")
+
+	assertions.Equal([]config.MongoIndex{desired[1]}, diff.Missing, "expected compound index to be missing")
+	assertions.Equal("subscriptionId_1_modified_-1", mongo.IndexName(diff.Missing[0]), "expected generated index name")
+	assertions.Equal([]config.MongoIndex{desired[2]}, diff.Changed, "expected partial filter to differ")
+	assertions.Equal([]string{"event.id_1"}, diff.Unchanged)
+	assertions.Equal([]string{"status_1"}, diff.Unmanaged)
+}
+
+func TestDiffIndexes_InvalidPartialFilter(t *testing.T) {
+	var assertions = assert.New(t)
+	var desired = []config.MongoIndex{
+		{Keys: []config.MongoIndexKey{{Field: "status"}}, PartialFilter: "{status"},
+	}
+
+	_, err := mongo.DiffIndexes(desired, nil)
+	assertions.NotNil(err, "expected invalid partial filter to be rejected")
+}
+
+func TestCollections(t *testing.T) {
+	var assertions = assert.New(t)
+	var messageFilter, err = filter.NewFilter([]config.Filter{
+		{Name: "callbacks", Expression: `document.deliveryType == "CALLBACK"`, Action: filter.ActionRoute, Collection: "callbacks"},
+		{Name: "metadata", Expression: `headers["type"] == "METADATA"`, Action: filter.ActionDrop},
+		{Name: "sse", Expression: `document.deliveryType == "SSE"`, Action: filter.ActionRoute, Collection: "status"},
+		{Name: "failed", Expression: `document.status == "FAILED"`, Action: filter.ActionRoute, Collection: "callbacks"},
+	})
+	assertions.Nil(err, "expected no error")
+
+	assertions.Equal([]string{"status", "callbacks"}, mongo.Collections(&config.Mongo{Collection: "status"}, messageFilter))
+	assertions.Equal([]string{"status"}, mongo.Collections(&config.Mongo{Collection: "status"}, nil))
+}
@@ -7,19 +7,27 @@ package mongo
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/IBM/sarama"
 	"github.com/rs/zerolog/log"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
 	"sync"
 	"time"
 	"vortex/service/config"
-	"vortex/service/kafka"
+	"vortex/service/filter"
+	"vortex/service/identity"
 	"vortex/service/metrics"
+	"vortex/service/status"
+	"vortex/service/tracing"
 	"vortex/service/transforms"
 	"vortex/service/utils"
+	"vortex/service/validation"
 )
 
 type Connection struct {
@@ -27,51 +35,132 @@ type Connection struct {
 	config            *config.Mongo
 	connectionContext context.Context
 	connectionCancel  context.CancelFunc
-	source            *kafka.Consumer
+	writeContext      context.Context
+	writeCancel       context.CancelFunc
+	writeBulk         bulkWriter
+	stopped           chan bool
+	source            Source
 	updateOptions     *options.UpdateOptions
-	bulk              []mongo.WriteModel
+	sizer             *BulkSizer
+	buffer            *bulk
+	lingerTimer       *time.Timer
 	mutex             sync.Mutex
+	bulks             chan *bulk
+	keyLock           *keyLock
+	writerGroup       sync.WaitGroup
+	expiry            *expiry
+	derivedFields     []string
+	filter            *filter.Filter
+	validator         *validation.Validator
+	identities        *identity.Routes
+	updates           *updateBuilders
+	outputs           []Output
 }
 
-func NewConnection(config *config.Mongo, source *kafka.Consumer) (*Connection, error) {
-	var clientOpts = options.Client()
-	var ctx, cancel = context.WithCancel(context.Background())
+// Source provides the consumed messages and is notified once they have been written. See kafka.Consumer.
+type Source interface {
+	GetOutput() <-chan *sarama.ConsumerMessage
+	Acknowledge(messages ...*sarama.ConsumerMessage)
+	Expect(message *sarama.ConsumerMessage, acknowledgements int)
+	CommitOffsets()
+}
 
-	var writeConcern = &writeconcern.WriteConcern{
-		W:       config.WriteConcern.Writes,
-		Journal: &config.WriteConcern.Journal,
-	}
+// bulkWriter writes the models of a bulk to a collection. See Connection.bulkWrite.
+type bulkWriter func(ctx context.Context, collection string, models []mongo.WriteModel) (*mongo.BulkWriteResult, error)
 
-	clientOpts.ApplyURI(config.Url)
-	clientOpts.SetWriteConcern(writeConcern)
+// Output receives every transformed document in addition to the database. It has to acknowledge the message at
+// the source once the document has been written.
+type Output interface {
+	Send(message *sarama.ConsumerMessage, document map[string]any) error
+	Close()
+}
 
-	var client, err = mongo.Connect(ctx, clientOpts)
+// NewConnection creates the sink writing consumed messages to the database and the given outputs.
+// If the database is disabled, messages are only written to the outputs and no connection is established.
+func NewConnection(config *config.Mongo, source Source, filter *filter.Filter, validator *validation.Validator, identities *identity.Routes, outputs ...Output) (*Connection, error) {
+	var updates, err = newUpdateBuilders(config)
 	if err != nil {
-		cancel()
-		return nil, err
+		return nil, fmt.Errorf("invalid update configuration: %w", err)
+	}
+
+	var ctx, cancel = context.WithCancel(context.Background())
+
+	var client *mongo.Client
+	if config.Enabled {
+		if client, err = Connect(ctx, config); err != nil {
+			cancel()
+			return nil, err
+		}
 	}
 
 	var updateOptions = options.Update()
 	var enableUpsert = true
 	updateOptions.Upsert = &enableUpsert
 
-	return &Connection{
+	// pending bulks are still written after the connection has been stopped, so the writers have their own context
+	var writeCtx, writeCancel = context.WithCancel(context.Background())
+
+	var connection = &Connection{
 		client:            client,
 		config:            config,
 		source:            source,
 		connectionContext: ctx,
 		connectionCancel:  cancel,
+		writeContext:      writeCtx,
+		writeCancel:       writeCancel,
+		stopped:           make(chan bool),
 		updateOptions:     updateOptions,
-		bulk:              make([]mongo.WriteModel, 0),
-	}, nil
+		sizer:             NewBulkSizer(config),
+		buffer:            newBulk(config.Coalesce),
+		bulks:             make(chan *bulk),
+		keyLock:           newKeyLock(),
+		expiry:            newExpiry(&config.Retention),
+		derivedFields:     DerivedFields(config),
+		filter:            filter,
+		validator:         validator,
+		identities:        identities,
+		updates:           updates,
+		outputs:           outputs,
+	}
+	if client != nil {
+		connection.writeBulk = connection.bulkWrite
+	}
+	return connection, nil
+}
+
+// Connect creates a client for the configured database.
+func Connect(ctx context.Context, config *config.Mongo) (*mongo.Client, error) {
+	var clientOpts = options.Client()
+
+	var writeConcern = &writeconcern.WriteConcern{
+		W:       config.WriteConcern.Writes,
+		Journal: &config.WriteConcern.Journal,
+	}
+
+	clientOpts.ApplyURI(config.Url)
+	clientOpts.SetWriteConcern(writeConcern)
+
+	return mongo.Connect(ctx, clientOpts)
 }
 
 func (c *Connection) Start(processGroup *sync.WaitGroup) {
-	if err := c.client.Ping(context.TODO(), nil); err != nil {
-		log.Fatal().Err(err).Msg("Could not connect to database")
+	if c.client != nil {
+		if err := c.client.Ping(context.TODO(), nil); err != nil {
+			log.Fatal().Err(err).Msg("Could not connect to database")
+		}
+		log.Info().Msg("Database connection established")
+		c.ensureIndexes()
+	}
+
+	if c.writeBulk != nil {
+		go c.flushWithInterval(time.Duration(c.config.FlushIntervalSec) * time.Second)
+
+		var writers = max(c.config.Writers, 1)
+		c.writerGroup.Add(writers)
+		for i := 0; i < writers; i++ {
+			go c.write()
+		}
 	}
-	log.Info().Msg("Database connection established")
-	go c.flushWithInterval(time.Duration(c.config.FlushIntervalSec) * time.Second)
 
 	defer processGroup.Done()
 	for {
@@ -85,10 +174,17 @@ func (c *Connection) Start(processGroup *sync.WaitGroup) {
 
 		case <-c.connectionContext.Done():
 			c.flush()
+			close(c.bulks)
+			c.writerGroup.Wait()
+			c.writeCancel()
+			for _, output := range c.outputs {
+				output.Close()
+			}
+			close(c.stopped)
 			return
 
 		default:
-			if c.connectionContext.Err() != nil {
+			if c.client != nil && c.connectionContext.Err() != nil {
 				if err := c.client.Disconnect(c.connectionContext); err != nil {
 					log.Fatal().Err(err).Msg("Could no disconnect from database")
 				}
@@ -98,93 +194,301 @@ func (c *Connection) Start(processGroup *sync.WaitGroup) {
 	}
 }
 
+// Stop flushes all pending documents and waits until they have been written to the database and all outputs.
 func (c *Connection) Stop() {
 	c.connectionCancel()
+	<-c.stopped
+}
+
+// ensureIndexes reconciles the indexes of the default collection and all collections messages may be routed to.
+// Missing indexes are built before any message is consumed, which blocks startup until MongoDB has built them.
+func (c *Connection) ensureIndexes() {
+	var desired = DesiredIndexes(c.config)
+	for _, name := range Collections(c.config, c.filter) {
+		var collection = c.client.Database(c.config.Database).Collection(name)
+		var diff, err = NewIndexManager(collection, desired).Reconcile(c.connectionContext)
+		if err != nil {
+			log.Fatal().Err(err).Str("collection", name).Msg("Could not ensure indexes")
+		}
+
+		for _, index := range diff.Missing {
+			log.Info().Str("collection", name).Msgf("Created index %s", IndexName(index))
+		}
+
+		for _, index := range diff.Changed {
+			log.Warn().Str("collection", name).Msgf("Index %s differs from its configuration and has to be re-created manually", IndexName(index))
+		}
+	}
 }
 
 func (c *Connection) upsert(message *sarama.ConsumerMessage) error {
 	var document map[string]any
-	var filter = bson.M{"_id": string(message.Key)}
 
 	if message.Value == nil {
+		c.source.Acknowledge(message)
 		return nil
 	}
 
+	if c.config.TypedDecoding && len(message.Key) > 0 {
+		if decoded, err := status.Decode(message.Value, c.derivedFields...); err == nil {
+			return c.upsertTyped(message, decoded)
+		}
+		metrics.RecordTypedDecodingFallback()
+	}
+
 	if err := json.Unmarshal(message.Value, &document); err != nil {
 		return err
 	}
 	delete(document, "_id")
 
-	if castedEvent, ok := document["event"].(map[string]any); ok {
-		if castedId, ok := castedEvent["id"]; ok {
-			filter["event.id"] = castedId
-		} else {
-			log.Warn().Fields(map[string]any{
-				"partition": message.Partition,
-				"offset":    message.Offset,
-			}).Msg("Detected faulty message. Skipping!")
-			return nil
-		}
-	} else {
-		log.Warn().Fields(map[string]any{
-			"partition": message.Partition,
-			"offset":    message.Offset,
-		}).Msg("Detected faulty message. Skipping!")
+	var ctx, span = tracing.StartConsume(message, document)
+
+	var decision = c.filter.Evaluate(message, document)
+	if decision.Drop {
+		log.Debug().Fields(utils.GetFieldsFromMessage(message)).Str("filter", decision.Rule).Msg("Dropped message")
+		metrics.RecordFiltered(decision.Rule)
+		c.source.Acknowledge(message)
+		span.End()
 		return nil
 	}
 
-	document["topic"] = message.Topic
-	var transformedDoc, err = transforms.GlobalRegistry.ApplyTransforms(document)
+	if violation := c.validator.Validate(message, document); violation != nil {
+		if err := c.validator.Reject(message, violation); err != nil {
+			span.End()
+			return err
+		}
+
+		c.source.Acknowledge(message)
+		span.End()
+		return nil
+	}
+
+	var collection = c.config.Collection
+	if len(decision.Collection) > 0 {
+		collection = decision.Collection
+	}
+
+	var identity = c.identities.For(decision.Rule)
+	filter, err := identity.Filter(message, document)
 	if err != nil {
+		span.End()
+		if err := identity.Reject(message, err); err != nil {
+			return err
+		}
+
+		c.source.Acknowledge(message)
+		return nil
+	}
+
+	document["topic"] = message.Topic
+	var _, transformSpan = tracing.Tracer().Start(ctx, "transform")
+	transformedDoc, err := transforms.GlobalRegistry.ApplyMessageTransforms(message, document)
+	transformSpan.End()
+	if errors.Is(err, transforms.ErrMessageDropped) {
+		log.Debug().Fields(utils.GetFieldsFromMessage(message)).Err(err).Msg("Dropped message")
+		c.source.Acknowledge(message)
+		span.End()
+		return nil
+	} else if err != nil {
 		log.Fatal().Fields(utils.GetFieldsFromMessage(message)).Err(err).Msg("Could not apply transformations to document")
 	}
 
+	var insertExpiry = setExpiry(c.expiry, c.config.Retention.Field, transformedDoc)
+
 	var messageType = utils.GetHeader(message.Headers, "type")
 	if messageType == "MESSAGE" {
+		deleteField(transformedDoc, "coordinates")
 		transformedDoc["coordinates"] = map[string]any{"partition": message.Partition, "offset": message.Offset}
 		transformedDoc["timestamp"] = message.Timestamp
 	}
 
-	var update = bson.M{"$set": transformedDoc}
+	if len(c.outputs) > 0 {
+		var sinks = len(c.outputs)
+		if c.writeBulk != nil {
+			sinks++
+		}
+		if sinks > 1 {
+			c.source.Expect(message, sinks)
+		}
 
-	c.mutex.Lock()
-	c.bulk = append(c.bulk, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true))
-	c.mutex.Unlock()
+		for _, output := range c.outputs {
+			if err := output.Send(message, transformedDoc); err != nil {
+				span.End()
+				return err
+			}
+		}
+	}
 
-	if len(c.bulk) >= c.config.BulkSize {
-		c.flush()
+	if c.writeBulk == nil {
+		span.End()
+		return nil
+	}
+
+	// the placeholder already got the default expiry when it was created
+	var update = c.updates.build(messageType, transformedDoc)
+	var completion = c.updates.completion(messageType, update)
+	if !insertExpiry.IsZero() {
+		addField(update, "$setOnInsert", c.config.Retention.Field, insertExpiry)
+	}
+
+	c.enqueue(message, span, &bulkEntry{collection, filter, update, completion})
+	return nil
+}
+
+// DerivedFields returns the fields added to the written documents in addition to the transformed payload.
+// They are dropped when documents are archived, since replaying them would conflict with the fields added again.
+func DerivedFields(mongoConfig *config.Mongo) []string {
+	var fields = []string{"coordinates"}
+	if mongoConfig.Retention.Enabled {
+		fields = append(fields, mongoConfig.Retention.Field)
+	}
+	return fields
+}
+
+// deleteField deletes the given field of a flattened document along with all fields nested in it, which would
+// conflict with the field being written.
+func deleteField(document map[string]any, field string) {
+	for key := range document {
+		if key == field || strings.HasPrefix(key, field+".") {
+			delete(document, key)
+		}
+	}
+}
+
+// upsertTyped upserts a status message decoded by the status package, which has already been transformed by the
+// default transformations. It is only used if neither filters, validation, custom transformations nor a custom
+// identity are configured. Payloads containing derived fields are decoded generically.
+func (c *Connection) upsertTyped(message *sarama.ConsumerMessage, decoded *status.Message) error {
+	var ctx, span = tracing.StartConsume(message, decoded.TracingFields())
+
+	var _, transformSpan = tracing.Tracer().Start(ctx, "transform")
+	var document = decoded.Document(message.Topic, time.Now().UTC())
+	transformSpan.End()
+
+	var update = bson.M{}
+	if c.expiry != nil {
+		var expireAt, explicit = c.expiry.at(decoded.EventRetentionTime, decoded.Status)
+		if explicit {
+			document = status.SetElement(document, c.config.Retention.Field, expireAt)
+		} else {
+			update["$setOnInsert"] = bson.M{c.config.Retention.Field: expireAt}
+		}
+	}
+
+	var messageType = utils.GetHeader(message.Headers, "type")
+	if messageType == "MESSAGE" {
+		document = append(document, bson.E{Key: "coordinates", Value: bson.D{{Key: "partition", Value: message.Partition}, {Key: "offset", Value: message.Offset}}})
+		document = status.SetElement(document, "timestamp", message.Timestamp)
 	}
 
+	var filter = bson.M{"_id": string(message.Key), "event.id": decoded.Event.Id}
+	update["$set"] = document
+	c.enqueue(message, span, &bulkEntry{c.config.Collection, filter, update, nil})
 	return nil
 }
 
+// enqueue adds an update to the buffer and flushes it once it is full.
+func (c *Connection) enqueue(message *sarama.ConsumerMessage, span trace.Span, entry *bulkEntry) {
+	var documentSize = len(message.Value)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// The payload size is only an estimate of the BSON size, but it is an upper bound for the transformed document
+	// since transformations mostly drop fields (e.g. httpHeaders and event.data).
+	if c.buffer.len() > 0 && c.exceedsBulkBytes(c.buffer.bytes+documentSize) {
+		c.flushLocked()
+	}
+
+	if c.buffer.len() == 0 && c.config.MaxLingerMs > 0 {
+		c.lingerTimer = time.AfterFunc(time.Duration(c.config.MaxLingerMs)*time.Millisecond, c.flush)
+	}
+
+	c.buffer.add(entry, message, span, documentSize)
+
+	if c.buffer.len() >= c.sizer.Current() || c.exceedsBulkBytes(c.buffer.bytes+1) {
+		c.flushLocked()
+	}
+}
+
+func (c *Connection) exceedsBulkBytes(size int) bool {
+	return c.config.MaxBulkBytes > 0 && size > c.config.MaxBulkBytes
+}
+
 func (c *Connection) flush() {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	c.flushLocked()
+}
 
-	if len(c.bulk) == 0 {
+// flushLocked hands the current buffer off to the writers and starts a fresh one.
+// It blocks while all writers are busy or while a bulk-write for one of the buffered keys is still in flight,
+// which keeps the order of updates for the same document intact.
+func (c *Connection) flushLocked() {
+	if c.buffer.len() == 0 {
 		return
 	}
 
-	var opts = options.BulkWrite().SetOrdered(false)
-	var database = c.client.Database(c.config.Database)
-	var collection = database.Collection(c.config.Collection)
-
-	result, err := collection.BulkWrite(c.connectionContext, c.bulk, opts)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Could not perform bulk-write")
+	if c.lingerTimer != nil {
+		c.lingerTimer.Stop()
+		c.lingerTimer = nil
 	}
 
-	var fields = map[string]any{
-		"upserted": result.UpsertedCount,
-		"inserted": result.InsertedCount,
-		"modified": result.ModifiedCount,
+	var pending = c.buffer
+	c.buffer = newBulk(c.config.Coalesce)
+
+	c.keyLock.acquire(pending.keys)
+	c.bulks <- pending
+}
+
+func (c *Connection) write() {
+	defer c.writerGroup.Done()
+
+	for pending := range c.bulks {
+		var span = tracing.StartBulkWrite(c.config.Collection, pending.spans)
+		var start = time.Now()
+		var result = new(mongo.BulkWriteResult)
+		for collection, models := range pending.models() {
+			collectionResult, err := c.writeBulk(c.writeContext, collection, models)
+			if err != nil {
+				span.RecordError(err)
+				span.End()
+				log.Fatal().Err(err).Str("collection", collection).Msg("Could not perform bulk-write")
+			}
+
+			result.UpsertedCount += collectionResult.UpsertedCount
+			result.InsertedCount += collectionResult.InsertedCount
+			result.ModifiedCount += collectionResult.ModifiedCount
+		}
+		var latency = time.Since(start)
+		span.End()
+		pending.persisted()
+		var bulkSize = c.sizer.Observe(latency, pending.len())
+
+		c.keyLock.release(pending.keys)
+		c.source.Acknowledge(pending.messages...)
+
+		var fields = map[string]any{
+			"upserted": result.UpsertedCount,
+			"inserted": result.InsertedCount,
+			"modified": result.ModifiedCount,
+			"bytes":    pending.bytes,
+			"latency":  latency.String(),
+			"bulkSize": bulkSize,
+			"messages": len(pending.messages),
+		}
+		log.Debug().Fields(fields).Msgf("Completed bulk-write")
+		metrics.RecordUpserts(float64(pending.len()))
+		metrics.RecordCoalescing(len(pending.messages), pending.len(), pending.coalescingRatio())
+		metrics.RecordBulkWrite(latency, bulkSize)
+
+		c.source.CommitOffsets()
 	}
-	log.Debug().Fields(fields).Msgf("Completed bulk-write")
-	metrics.RecordUpserts(float64(len(c.bulk)))
+}
 
-	c.bulk = make([]mongo.WriteModel, 0)
-	c.source.CommitOffsets()
+func (c *Connection) bulkWrite(ctx context.Context, collection string, models []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+	var opts = options.BulkWrite().SetOrdered(false)
+	return c.client.Database(c.config.Database).Collection(collection).BulkWrite(ctx, models, opts)
 }
 
 func (c *Connection) flushWithInterval(interval time.Duration) {
@@ -195,8 +499,6 @@ func (c *Connection) flushWithInterval(interval time.Duration) {
 			return
 		}
 
-		if len(c.bulk) > 0 {
-			c.flush()
-		}
+		c.flush()
 	}
 }
@@ -0,0 +1,314 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package mongo_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodriver "go.mongodb.org/mongo-driver/mongo"
+	"maps"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"vortex/service/archive"
+	"vortex/service/config"
+	"vortex/service/mongo"
+)
+
+type testSource struct {
+	output       chan *sarama.ConsumerMessage
+	mutex        sync.Mutex
+	acknowledged []*sarama.ConsumerMessage
+}
+
+func (s *testSource) GetOutput() <-chan *sarama.ConsumerMessage {
+	return s.output
+}
+
+func (s *testSource) Acknowledge(messages ...*sarama.ConsumerMessage) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.acknowledged = append(s.acknowledged, messages...)
+}
+
+func (s *testSource) Expect(*sarama.ConsumerMessage, int) {}
+
+func (s *testSource) CommitOffsets() {}
+
+func TestConnection_Stop(t *testing.T) {
+	var assertions = assert.New(t)
+	var source = &testSource{output: make(chan *sarama.ConsumerMessage)}
+	var mongoConfig = &config.Mongo{Collection: "status", BulkSize: 100, FlushIntervalSec: 60, Writers: 2}
+
+	var written []mongodriver.WriteModel
+	var write = func(ctx context.Context, collection string, models []mongodriver.WriteModel) (*mongodriver.BulkWriteResult, error) {
+		assertions.Nil(ctx.Err(), "expected the bulk to be written before the writers are cancelled")
+		written = append(written, models...)
+		return new(mongodriver.BulkWriteResult), nil
+	}
+
+	var connection, err = mongo.NewBufferedConnection(mongoConfig, source, write)
+	assertions.Nil(err, "expected no error")
+
+	var processGroup sync.WaitGroup
+	processGroup.Add(1)
+	go connection.Start(&processGroup)
+
+	for _, key := range []string{"1", "2", "3"} {
+		var message = &sarama.ConsumerMessage{Key: []byte(key), Value: []byte("{}")}
+		connection.Enqueue(message, bson.M{"_id": key}, bson.M{"$set": bson.M{"status": "DELIVERED"}})
+	}
+	assertions.Empty(written, "expected the documents to be buffered")
+
+	connection.Stop()
+	processGroup.Wait()
+	assertions.Len(written, 3, "expected the buffered documents to be written on stop")
+	assertions.Len(source.acknowledged, 3, "expected the buffered messages to be acknowledged")
+}
+
+// upsertAll writes the given messages with a new connection and returns the updates of their documents.
+func upsertAll(t *testing.T, mongoConfig *config.Mongo, source *testSource, outputs []mongo.Output, messages ...*sarama.ConsumerMessage) []bson.M {
+	var updates []bson.M
+	for _, model := range writeAll(t, mongoConfig, source, outputs, messages...) {
+		updates = append(updates, model.Update.(bson.M))
+	}
+	return updates
+}
+
+// writeAll writes the given messages with a new connection and returns the written models.
+func writeAll(t *testing.T, mongoConfig *config.Mongo, source *testSource, outputs []mongo.Output, messages ...*sarama.ConsumerMessage) []*mongodriver.UpdateOneModel {
+	var written []*mongodriver.UpdateOneModel
+	var write = func(ctx context.Context, collection string, models []mongodriver.WriteModel) (*mongodriver.BulkWriteResult, error) {
+		for _, model := range models {
+			written = append(written, model.(*mongodriver.UpdateOneModel))
+		}
+		return new(mongodriver.BulkWriteResult), nil
+	}
+
+	var connection, err = mongo.NewBufferedConnection(mongoConfig, source, write, outputs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var processGroup sync.WaitGroup
+	processGroup.Add(1)
+	go connection.Start(&processGroup)
+	for _, message := range messages {
+		if err := connection.Upsert(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	connection.Stop()
+	processGroup.Wait()
+	return written
+}
+
+func TestConnection_Replay(t *testing.T) {
+	var assertions = assert.New(t)
+	var directory = t.TempDir()
+	var mongoConfig = &config.Mongo{
+		Collection:       "status",
+		BulkSize:         100,
+		FlushIntervalSec: 60,
+		Retention:        config.MongoRetention{Enabled: true, Field: "expireAt", ClassesSec: map[string]int{"default": 3600}},
+	}
+
+	var payload, err = os.ReadFile("../../testdata/kafka_msg.json")
+	assertions.Nil(err, "expected no error")
+	var message = &sarama.ConsumerMessage{
+		Topic:     "status",
+		Partition: 1,
+		Offset:    7,
+		Key:       []byte("9475695c"),
+		Value:     payload,
+		Headers:   []*sarama.RecordHeader{{Key: []byte("type"), Value: []byte("MESSAGE")}},
+	}
+
+	var source = &testSource{output: make(chan *sarama.ConsumerMessage)}
+	sink, err := archive.NewSink(&config.File{Target: archive.TargetFile, Directory: directory, Prefix: "status"}, source, mongo.DerivedFields(mongoConfig)...)
+	assertions.Nil(err, "expected no error")
+	var original = upsertAll(t, mongoConfig, source, []mongo.Output{sink}, message)
+
+	fileSource, err := archive.NewSource(&config.Source{Type: archive.TypeFile, Path: directory, Topic: "status"}, mongo.DerivedFields(mongoConfig)...)
+	assertions.Nil(err, "expected no error")
+	var processGroup sync.WaitGroup
+	processGroup.Add(1)
+	go fileSource.Start(&processGroup)
+
+	var replayed []bson.M
+	select {
+	case message := <-fileSource.GetOutput():
+		replayed = upsertAll(t, mongoConfig, &testSource{}, nil, message)
+	case <-time.After(time.Second):
+		t.Fatal("expected the archived record to be read")
+	}
+	fileSource.Stop()
+
+	assertions.Len(original, 1)
+	assertions.Len(replayed, 1)
+	var document = replayed[0]["$set"].(map[string]any)
+	assertions.Equal(map[string]any{"partition": int32(1), "offset": int64(7)}, document["coordinates"], "expected the coordinates of the record")
+	assertions.IsType(time.Time{}, document["expireAt"], "expected the expiry to be derived again")
+	for field := range document {
+		for other := range document {
+			assertions.False(strings.HasPrefix(other, field+"."), "expected '%s' not to conflict with '%s'", other, field)
+		}
+	}
+}
+
+// fieldsOf returns the fields written by an update operator.
+func fieldsOf(fields any) []string {
+	var keys []string
+	switch fields := fields.(type) {
+	case bson.D:
+		for _, element := range fields {
+			keys = append(keys, element.Key)
+		}
+	case bson.M:
+		for key := range fields {
+			keys = append(keys, key)
+		}
+	case map[string]any:
+		for key := range fields {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func TestConnection_DerivedFields(t *testing.T) {
+	var payload map[string]any
+	var data, err = os.ReadFile("../../testdata/kafka_msg.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, json.Unmarshal(data, &payload))
+	payload["expireAt"] = "2024-01-03T06:10:35Z"
+	payload["coordinates"] = map[string]any{"partition": 9, "offset": 99}
+	data, _ = json.Marshal(payload)
+
+	for _, typedDecoding := range []bool{true, false} {
+		t.Run(fmt.Sprintf("typedDecoding=%t", typedDecoding), func(t *testing.T) {
+			var assertions = assert.New(t)
+			var mongoConfig = &config.Mongo{
+				Collection:       "status",
+				BulkSize:         100,
+				FlushIntervalSec: 60,
+				TypedDecoding:    typedDecoding,
+				Retention:        config.MongoRetention{Enabled: true, Field: "expireAt", DefaultSec: 3600},
+			}
+			var message = &sarama.ConsumerMessage{
+				Topic:     "status",
+				Partition: 1,
+				Offset:    7,
+				Key:       []byte("9475695c"),
+				Value:     data,
+				Headers:   []*sarama.RecordHeader{{Key: []byte("type"), Value: []byte("MESSAGE")}},
+			}
+
+			var updates = upsertAll(t, mongoConfig, &testSource{}, nil, message)
+			assertions.Len(updates, 1)
+
+			var set = updates[0]["$set"].(map[string]any)
+			assertions.Equal(map[string]any{"partition": int32(1), "offset": int64(7)}, set["coordinates"], "expected the coordinates of the message")
+			assertions.NotContains(set, "expireAt", "expected the expiry of the payload to be replaced")
+			assertions.IsType(time.Time{}, updates[0]["$setOnInsert"].(bson.M)["expireAt"])
+
+			var fields = append(fieldsOf(updates[0]["$set"]), fieldsOf(updates[0]["$setOnInsert"])...)
+			for i, field := range fields {
+				for j, other := range fields {
+					assertions.False(i != j && (field == other || strings.HasPrefix(other, field+".")), "expected '%s' not to conflict with '%s'", other, field)
+				}
+			}
+		})
+	}
+}
+
+// apply applies the given models to the documents by their _id like MongoDB does, as far as $set, $setOnInsert and
+// $unset are concerned.
+func apply(documents map[string]bson.M, models []*mongodriver.UpdateOneModel) {
+	for _, model := range models {
+		var filter = model.Filter.(bson.M)
+		var update = model.Update.(bson.M)
+		var id = filter["_id"].(string)
+
+		var document, exists = documents[id]
+		if placeholder, ok := filter["_placeholder"]; ok && (!exists || document["_placeholder"] != placeholder) {
+			continue
+		}
+		if !exists {
+			if model.Upsert == nil || !*model.Upsert {
+				continue
+			}
+			document = bson.M{}
+			documents[id] = document
+			maps.Copy(document, toMap(update["$setOnInsert"]))
+		}
+
+		maps.Copy(document, toMap(update["$set"]))
+		for field := range toMap(update["$unset"]) {
+			delete(document, field)
+		}
+	}
+}
+
+func toMap(fields any) map[string]any {
+	switch fields := fields.(type) {
+	case bson.M:
+		return fields
+	case map[string]any:
+		return fields
+	}
+	return nil
+}
+
+func TestConnection_Placeholder(t *testing.T) {
+	var metadata = &sarama.ConsumerMessage{
+		Key:     []byte("1"),
+		Value:   []byte(`{"event": {"id": "1", "type": "vortex.test.event"}, "status": "DELIVERED"}`),
+		Headers: []*sarama.RecordHeader{{Key: []byte("type"), Value: []byte("METADATA")}},
+	}
+	var message = &sarama.ConsumerMessage{
+		Key:     []byte("1"),
+		Value:   []byte(`{"event": {"id": "1", "type": "vortex.test.event"}, "status": "PROCESSED", "subscriptionId": "1"}`),
+		Headers: []*sarama.RecordHeader{{Key: []byte("type"), Value: []byte("MESSAGE")}},
+	}
+
+	for _, coalesce := range []bool{false, true} {
+		t.Run(fmt.Sprintf("coalesce=%t", coalesce), func(t *testing.T) {
+			var assertions = assert.New(t)
+			var mongoConfig = &config.Mongo{
+				Collection:       "status",
+				BulkSize:         100,
+				FlushIntervalSec: 60,
+				Coalesce:         coalesce,
+				SetOnInsert:      []string{"subscriptionId"},
+				Updates:          []config.MongoUpdate{{Type: "METADATA", Set: []string{"status"}}},
+			}
+
+			var documents = make(map[string]bson.M)
+			if coalesce {
+				apply(documents, writeAll(t, mongoConfig, &testSource{}, nil, metadata, message))
+			} else {
+				apply(documents, writeAll(t, mongoConfig, &testSource{}, nil, metadata))
+				assertions.Equal(true, documents["1"]["_placeholder"], "expected METADATA to create a placeholder")
+				apply(documents, writeAll(t, mongoConfig, &testSource{}, nil, message))
+			}
+
+			assertions.Equal("1", documents["1"]["subscriptionId"], "expected the placeholder to be completed by fields written on insert")
+			assertions.NotContains(documents["1"], "_placeholder", "expected the placeholder to be completed")
+
+			apply(documents, writeAll(t, mongoConfig, &testSource{}, nil, metadata))
+			assertions.Equal("DELIVERED", documents["1"]["status"])
+			assertions.NotContains(documents["1"], "_placeholder", "expected existing documents not to become placeholders")
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package mongo
+
+import (
+	"slices"
+	"strings"
+	"time"
+	"vortex/service/config"
+)
+
+// expiry computes the point in time at which a document expires.
+// The retention is looked up by status first and by the eventRetentionTime of the subscription afterward.
+type expiry struct {
+	defaultRetention time.Duration
+	classRetention   map[string]time.Duration
+	statusRetention  map[string]time.Duration
+}
+
+// newExpiry returns the expiry of documents or nil if retention is disabled.
+func newExpiry(retention *config.MongoRetention) *expiry {
+	if !retention.Enabled {
+		return nil
+	}
+
+	return &expiry{
+		defaultRetention: seconds(retention.DefaultSec),
+		classRetention:   secondsMap(retention.ClassesSec),
+		statusRetention:  secondsMap(retention.StatusSec),
+	}
+}
+
+// at returns the expiry of a document with the given retention class and status and whether one of them determined
+// the retention. Otherwise, the expiry is based on the default retention.
+func (e *expiry) at(class string, status string) (time.Time, bool) {
+	var retention, ok = e.statusRetention[strings.ToLower(status)]
+	if !ok && len(class) > 0 {
+		retention, ok = e.classRetention[strings.ToLower(class)]
+	}
+
+	if !ok {
+		retention = e.defaultRetention
+	}
+	return time.Now().UTC().Add(retention), ok
+}
+
+// setExpiry sets the expiry field of the document if its retention is determined by its status or retention class.
+// Otherwise, the expiry by the default retention is returned, which is only written when the document is created,
+// so that records without a class (e.g. METADATA) do not overwrite the expiry set by the record carrying it.
+func setExpiry(expiry *expiry, field string, document map[string]any) time.Time {
+	if expiry == nil {
+		return time.Time{}
+	}
+
+	var class, _ = document["eventRetentionTime"].(string)
+	var status, _ = document["status"].(string)
+	var expireAt, explicit = expiry.at(class, status)
+	deleteField(document, field)
+	if explicit {
+		document[field] = expireAt
+		return time.Time{}
+	}
+	return expireAt
+}
+
+// DesiredIndexes returns the configured indexes including a TTL index on the expiry field if retention is enabled,
+// unless an index for that field has been configured explicitly.
+func DesiredIndexes(mongoConfig *config.Mongo) []config.MongoIndex {
+	var indexes = mongoConfig.Indexes
+	var retention = mongoConfig.Retention
+	if !retention.Enabled {
+		return indexes
+	}
+
+	for _, index := range indexes {
+		if len(index.Keys) == 1 && index.Keys[0].Field == retention.Field {
+			return indexes
+		}
+	}
+
+	var expireAfterSeconds = int32(0)
+	return append(slices.Clone(indexes), config.MongoIndex{
+		Keys:               []config.MongoIndexKey{{Field: retention.Field, Order: 1}},
+		ExpireAfterSeconds: &expireAfterSeconds,
+	})
+}
+
+func seconds(value int) time.Duration {
+	return time.Duration(value) * time.Second
+}
+
+// secondsMap converts the given seconds to durations. Its keys are lower-cased to be matched case-insensitively.
+func secondsMap(values map[string]int) map[string]time.Duration {
+	var durations = make(map[string]time.Duration, len(values))
+	for key, value := range values {
+		durations[strings.ToLower(key)] = seconds(value)
+	}
+	return durations
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package mongo_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"vortex/service/config"
+	"vortex/service/mongo"
+)
+
+func TestDesiredIndexes(t *testing.T) {
+	var assertions = assert.New(t)
+	var mongoConfig = &config.Mongo{
+		Indexes:   []config.MongoIndex{{Keys: []config.MongoIndexKey{{Field: "event.id"}}}},
+		Retention: config.MongoRetention{Enabled: true, Field: "expireAt"},
+	}
+
+	var indexes = mongo.DesiredIndexes(mongoConfig)
+	assertions.Len(indexes, 2, "expected TTL index to be added")
+	assertions.Equal("expireAt_1", mongo.IndexName(indexes[1]))
+	assertions.Equal(int32(0), *indexes[1].ExpireAfterSeconds)
+	assertions.Len(mongoConfig.Indexes, 1, "expected configuration to be unchanged")
+
+	mongoConfig.Retention.Enabled = false
+	assertions.Len(mongo.DesiredIndexes(mongoConfig), 1, "expected no TTL index without retention")
+}
+
+func TestExpiryAt(t *testing.T) {
+	var assertions = assert.New(t)
+	var retention = &config.MongoRetention{
+		Enabled:    true,
+		DefaultSec: 3600,
+		ClassesSec: map[string]int{"default": 604800},
+		StatusSec:  map[string]int{"delivered": 86400},
+	}
+
+	var cases = []struct {
+		name     string
+		class    string
+		status   string
+		expected time.Duration
+		explicit bool
+	}{
+		{"class", "DEFAULT", "PROCESSED", 7 * 24 * time.Hour, true},
+		{"status", "DEFAULT", "DELIVERED", 24 * time.Hour, true},
+		{"unknown class", "TTL_1_HOUR", "", time.Hour, false},
+		{"no class", "", "DROPPED", time.Hour, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var before = time.Now().UTC()
+			var expireAt, explicit = mongo.ExpiryAt(retention, c.class, c.status)
+			assertions.WithinDuration(before.Add(c.expected), expireAt, time.Second)
+			assertions.Equal(c.explicit, explicit)
+		})
+	}
+}
+
+func TestSetExpiry(t *testing.T) {
+	var assertions = assert.New(t)
+	var retention = &config.MongoRetention{
+		Enabled:    true,
+		Field:      "expireAt",
+		DefaultSec: 3600,
+		ClassesSec: map[string]int{"default": 604800},
+		StatusSec:  map[string]int{"delivered": 86400},
+	}
+
+	var document = map[string]any{"eventRetentionTime": "DEFAULT", "status": "PROCESSED"}
+	assertions.True(mongo.SetExpiry(retention, document).IsZero(), "expected no expiry on insert only")
+	assertions.WithinDuration(time.Now().Add(7*24*time.Hour), document["expireAt"].(time.Time), time.Second, "expected the class to determine the expiry")
+
+	document = map[string]any{"status": "DELIVERED"}
+	assertions.True(mongo.SetExpiry(retention, document).IsZero(), "expected no expiry on insert only")
+	assertions.WithinDuration(time.Now().Add(24*time.Hour), document["expireAt"].(time.Time), time.Second, "expected the status to determine the expiry")
+
+	document = map[string]any{"status": "DROPPED"}
+	var insertExpiry = mongo.SetExpiry(retention, document)
+	assertions.NotContains(document, "expireAt", "expected records without a class to keep the existing expiry")
+	assertions.WithinDuration(time.Now().Add(time.Hour), insertExpiry, time.Second, "expected the default retention on insert")
+
+	assertions.True(mongo.SetExpiry(&config.MongoRetention{Field: "expireAt"}, document).IsZero(), "expected no expiry without retention")
+}
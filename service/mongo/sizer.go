@@ -0,0 +1,88 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package mongo
+
+import (
+	"sync"
+	"time"
+	"vortex/service/config"
+)
+
+const (
+	growFactor   = 1.25
+	shrinkFactor = 0.75
+)
+
+// BulkSizer determines how many documents are buffered before a bulk-write is triggered.
+// If adaptive bulks are enabled, the size grows while bulk-writes stay well below the target latency
+// and shrinks as soon as they exceed it.
+type BulkSizer struct {
+	current       int
+	adaptive      bool
+	targetLatency time.Duration
+	min           int
+	max           int
+	mutex         sync.Mutex
+}
+
+func NewBulkSizer(config *config.Mongo) *BulkSizer {
+	var sizer = &BulkSizer{
+		current:       config.BulkSize,
+		adaptive:      config.Adaptive.Enabled,
+		targetLatency: time.Duration(config.Adaptive.TargetLatencyMs) * time.Millisecond,
+		min:           config.Adaptive.MinBulkSize,
+		max:           config.Adaptive.MaxBulkSize,
+	}
+
+	if sizer.adaptive {
+		sizer.current = sizer.clamp(sizer.current)
+	}
+	return sizer
+}
+
+func (s *BulkSizer) Current() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.current
+}
+
+// Observe adjusts the bulk size based on the latency of a completed bulk-write containing count documents.
+// Bulks that were flushed before reaching the current size (e.g. by the linger timer) never cause growth.
+func (s *BulkSizer) Observe(latency time.Duration, count int) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.adaptive {
+		return s.current
+	}
+
+	switch {
+
+	case latency > s.targetLatency:
+		s.current = s.clamp(int(float64(s.current) * shrinkFactor))
+
+	case latency < s.targetLatency/2 && count >= s.current:
+		var grown = int(float64(s.current) * growFactor)
+		if grown == s.current {
+			grown++
+		}
+		s.current = s.clamp(grown)
+
+	}
+	return s.current
+}
+
+func (s *BulkSizer) clamp(size int) int {
+	if size < s.min {
+		size = s.min
+	}
+	if size > s.max {
+		size = s.max
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
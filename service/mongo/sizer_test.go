@@ -0,0 +1,44 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package mongo_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"vortex/service/config"
+	"vortex/service/mongo"
+)
+
+func TestBulkSizer_Static(t *testing.T) {
+	var assertions = assert.New(t)
+	var sizer = mongo.NewBulkSizer(&config.Mongo{BulkSize: 500})
+
+	assertions.Equal(500, sizer.Current())
+	assertions.Equal(500, sizer.Observe(time.Minute, 500), "expected static bulk size to ignore latency")
+	assertions.Equal(500, sizer.Observe(time.Nanosecond, 500), "expected static bulk size to ignore latency")
+}
+
+func TestBulkSizer_Adaptive(t *testing.T) {
+	var assertions = assert.New(t)
+	var sizer = mongo.NewBulkSizer(&config.Mongo{
+		BulkSize: 100,
+		Adaptive: config.MongoAdaptiveBulks{
+			Enabled:         true,
+			TargetLatencyMs: 100,
+			MinBulkSize:     50,
+			MaxBulkSize:     150,
+		},
+	})
+
+	assertions.Equal(125, sizer.Observe(10*time.Millisecond, 100), "expected bulk size to grow")
+	assertions.Equal(125, sizer.Observe(10*time.Millisecond, 20), "expected partial bulks to not cause growth")
+	assertions.Equal(125, sizer.Observe(80*time.Millisecond, 125), "expected bulk size to stay within tolerance")
+	assertions.Equal(150, sizer.Observe(10*time.Millisecond, 125), "expected bulk size to be capped")
+	assertions.Equal(112, sizer.Observe(200*time.Millisecond, 150), "expected bulk size to shrink")
+	assertions.Equal(84, sizer.Observe(200*time.Millisecond, 112), "expected bulk size to shrink")
+	assertions.Equal(63, sizer.Observe(200*time.Millisecond, 84), "expected bulk size to shrink")
+	assertions.Equal(50, sizer.Observe(200*time.Millisecond, 63), "expected bulk size to be floored")
+}
@@ -0,0 +1,273 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"maps"
+	"slices"
+	"strings"
+	"vortex/service/config"
+	"vortex/service/utils"
+)
+
+const (
+	OperatorInc = "inc"
+	OperatorMax = "max"
+	OperatorMin = "min"
+)
+
+// placeholderField marks documents created by a type with set, whose fields written on insert only are still missing.
+const placeholderField = "_placeholder"
+
+// operator updates a field with $inc, $max or $min. The value is either taken from the path from within the
+// transformed document or is the constant value. Operators are only applied to documents with one of the given
+// statuses, if any.
+type operator struct {
+	field    string
+	operator string
+	from     *utils.Path
+	value    any
+	statuses []string
+}
+
+func newOperator(operatorConfig config.MongoOperator) (*operator, error) {
+	if len(operatorConfig.Field) == 0 {
+		return nil, errors.New("operator has no field")
+	}
+
+	var op = &operator{
+		field:    operatorConfig.Field,
+		operator: operatorConfig.Operator,
+		value:    operatorConfig.Value,
+		statuses: operatorConfig.Statuses,
+	}
+
+	if len(operatorConfig.From) > 0 {
+		var from, err = utils.ParsePath(operatorConfig.From)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source field of operator %s of field '%s': %w", op.operator, op.field, err)
+		}
+		op.from = from
+	}
+
+	switch op.operator {
+
+	case OperatorInc:
+		if op.from == nil && op.value == nil {
+			op.value = 1
+		}
+
+	case OperatorMax, OperatorMin:
+		if op.from == nil && op.value == nil {
+			return nil, errors.New(fmt.Sprintf("operator %s of field '%s' requires a source field or a value", op.operator, op.field))
+		}
+
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown operator '%s' of field '%s'", op.operator, op.field))
+
+	}
+
+	if op.from != nil && op.value != nil {
+		return nil, errors.New(fmt.Sprintf("operator %s of field '%s' must either have a source field or a value", op.operator, op.field))
+	}
+	return op, nil
+}
+
+// apply returns the value of the operator for the given document and whether it applies to it.
+func (o *operator) apply(document map[string]any) (any, bool) {
+	if len(o.statuses) > 0 {
+		var status, _ = document["status"].(string)
+		if !slices.ContainsFunc(o.statuses, func(candidate string) bool { return strings.EqualFold(candidate, status) }) {
+			return nil, false
+		}
+	}
+
+	if o.from == nil {
+		return o.value, true
+	}
+
+	var value, ok = o.from.Get(document)
+	return value, ok && value != nil
+}
+
+// updateBuilder splits a transformed document into the operators of its upsert. Fields are matched by their name or
+// a prefix followed by a dot (e.g. "event" matches "event.id"). Fields matching setOnInsert are only written when the
+// document is created. If set is not empty, all other fields not matching it are written on insert as well, so that
+// the created document is a placeholder until a record of a type without set completes it. Fields updated by an
+// operator are neither set nor written on insert.
+type updateBuilder struct {
+	set         []string
+	setOnInsert []string
+	operators   []*operator
+}
+
+// updateBuilders holds the update builders per value of the "type" header and the builder of all other types.
+// If a type creates placeholders, the documents of all other types complete them. See completion.
+type updateBuilders struct {
+	types         map[string]*updateBuilder
+	defaultUpdate *updateBuilder
+	placeholders  bool
+}
+
+func newUpdateBuilders(mongoConfig *config.Mongo) (*updateBuilders, error) {
+	// the expiry is written by the sink depending on the status, so it can neither be written on insert only nor be
+	// updated by an operator
+	var expiryField string
+	if mongoConfig.Retention.Enabled {
+		expiryField = mongoConfig.Retention.Field
+	}
+	if field := overlapping(mongoConfig.SetOnInsert, expiryField); len(field) > 0 {
+		return nil, errors.New(fmt.Sprintf("field '%s' holds the expiry and cannot be written on insert", field))
+	}
+
+	var operators = make([]*operator, 0, len(mongoConfig.Operators))
+	var targets = make(map[string]bool, len(mongoConfig.Operators))
+	for i, operatorConfig := range mongoConfig.Operators {
+		var op, err = newOperator(operatorConfig)
+		if err != nil {
+			return nil, fmt.Errorf("invalid operator #%d: %w", i+1, err)
+		}
+
+		if targets[op.field] {
+			return nil, errors.New(fmt.Sprintf("field '%s' is updated by more than one operator", op.field))
+		}
+		if matches(mongoConfig.SetOnInsert, op.field) {
+			return nil, errors.New(fmt.Sprintf("field '%s' is written on insert and cannot be updated by an operator", op.field))
+		}
+		if len(overlapping([]string{op.field}, expiryField)) > 0 {
+			return nil, errors.New(fmt.Sprintf("field '%s' holds the expiry and cannot be updated by an operator", op.field))
+		}
+		targets[op.field] = true
+		operators = append(operators, op)
+	}
+
+	var builders = &updateBuilders{
+		types:         make(map[string]*updateBuilder, len(mongoConfig.Updates)),
+		defaultUpdate: &updateBuilder{setOnInsert: mongoConfig.SetOnInsert, operators: operators},
+	}
+
+	for i, updateConfig := range mongoConfig.Updates {
+		if len(updateConfig.Type) == 0 {
+			return nil, errors.New(fmt.Sprintf("update #%d has no type", i+1))
+		}
+
+		if _, ok := builders.types[updateConfig.Type]; ok {
+			return nil, errors.New(fmt.Sprintf("update of type '%s' is configured more than once", updateConfig.Type))
+		}
+
+		var builder = &updateBuilder{
+			set:         updateConfig.Set,
+			setOnInsert: append(slices.Clone(mongoConfig.SetOnInsert), updateConfig.SetOnInsert...),
+			operators:   operators,
+		}
+		if field := overlapping(updateConfig.SetOnInsert, expiryField); len(field) > 0 {
+			return nil, errors.New(fmt.Sprintf("field '%s' of type '%s' holds the expiry and cannot be written on insert", field, updateConfig.Type))
+		}
+		for _, field := range builder.set {
+			if matches(builder.setOnInsert, field) {
+				return nil, errors.New(fmt.Sprintf("field '%s' of type '%s' is written on insert and cannot be set as well", field, updateConfig.Type))
+			}
+		}
+
+		builders.types[updateConfig.Type] = builder
+		builders.placeholders = builders.placeholders || len(builder.set) > 0
+	}
+	return builders, nil
+}
+
+// build returns the update of a message of the given type.
+func (b *updateBuilders) build(messageType string, document map[string]any) bson.M {
+	var update = b.builder(messageType).build(document)
+	if b.placeholders && len(b.builder(messageType).set) > 0 {
+		addField(update, "$setOnInsert", placeholderField, true)
+	}
+	return update
+}
+
+// completion returns the update of a placeholder created by a type with set, which writes the fields the given update
+// of a message of the given type only writes on insert. It is nil if no type creates placeholders or if the type
+// creates them itself.
+func (b *updateBuilders) completion(messageType string, update bson.M) bson.M {
+	if !b.placeholders || len(b.builder(messageType).set) > 0 {
+		return nil
+	}
+
+	var completion = bson.M{"$unset": bson.M{placeholderField: ""}}
+	if fields, ok := update["$setOnInsert"].(bson.M); ok && len(fields) > 0 {
+		completion["$set"] = maps.Clone(fields)
+	}
+	return completion
+}
+
+func (b *updateBuilders) builder(messageType string) *updateBuilder {
+	if builder, ok := b.types[messageType]; ok {
+		return builder
+	}
+	return b.defaultUpdate
+}
+
+func (b *updateBuilder) build(document map[string]any) bson.M {
+	if len(b.set) == 0 && len(b.setOnInsert) == 0 && len(b.operators) == 0 {
+		return bson.M{"$set": document}
+	}
+
+	var update = make(bson.M, 2)
+	var targets = make(map[string]bool, len(b.operators))
+	for _, op := range b.operators {
+		targets[op.field] = true
+		if value, ok := op.apply(document); ok {
+			addField(update, "$"+op.operator, op.field, value)
+		}
+	}
+
+	for field, value := range document {
+		if targets[field] {
+			continue
+		}
+
+		if matches(b.setOnInsert, field) || (len(b.set) > 0 && !matches(b.set, field)) {
+			addField(update, "$setOnInsert", field, value)
+		} else {
+			addField(update, "$set", field, value)
+		}
+	}
+	return update
+}
+
+func addField(update bson.M, operator string, field string, value any) {
+	var fields, ok = update[operator].(bson.M)
+	if !ok {
+		fields = make(bson.M)
+		update[operator] = fields
+	}
+	fields[field] = value
+}
+
+// overlapping returns the first of the given fields that equals the field, contains it or is nested within it.
+func overlapping(fields []string, field string) string {
+	if len(field) == 0 {
+		return ""
+	}
+
+	for _, candidate := range fields {
+		if matches([]string{candidate}, field) || matches([]string{field}, candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// matches reports whether the field equals one of the given fields or is nested within one of them.
+func matches(fields []string, field string) bool {
+	for _, candidate := range fields {
+		if field == candidate || strings.HasPrefix(field, candidate+".") {
+			return true
+		}
+	}
+	return false
+}
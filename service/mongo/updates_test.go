@@ -0,0 +1,137 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package mongo_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+	"time"
+	"vortex/service/config"
+	"vortex/service/mongo"
+)
+
+var metadataUpdate = config.MongoUpdate{
+	Type:        "METADATA",
+	Set:         []string{"status", "modified", "properties.selectionFilterResult"},
+	SetOnInsert: []string{"event.type"},
+}
+
+func TestBuildUpdate(t *testing.T) {
+	var assertions = assert.New(t)
+	var document = map[string]any{
+		"status":                           "DROPPED",
+		"modified":                         1,
+		"event.id":                         "1",
+		"event.type":                       "vortex.test.event",
+		"properties.selectionFilterResult": "CONSUMER_FILTER_ERROR",
+		"properties.subscriber-id":         "subscriber",
+	}
+
+	var update, err = mongo.BuildUpdate(&config.Mongo{Updates: []config.MongoUpdate{metadataUpdate}}, "METADATA", document)
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(bson.M{
+		"$set": bson.M{"status": "DROPPED", "modified": 1, "properties.selectionFilterResult": "CONSUMER_FILTER_ERROR"},
+		"$setOnInsert": bson.M{
+			"_placeholder":             true,
+			"event.id":                 "1",
+			"event.type":               "vortex.test.event",
+			"properties.subscriber-id": "subscriber",
+		},
+	}, update, "expected fields outside the allowlist to be written on insert only")
+
+	update, err = mongo.BuildUpdate(&config.Mongo{Updates: []config.MongoUpdate{metadataUpdate}}, "MESSAGE", document)
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(bson.M{"$set": document}, update, "expected types without update to set the whole document")
+
+	update, err = mongo.BuildUpdate(&config.Mongo{Updates: []config.MongoUpdate{{Type: "MESSAGE", SetOnInsert: []string{"event"}}}}, "MESSAGE", document)
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(bson.M{"event.id": "1", "event.type": "vortex.test.event"}, update["$setOnInsert"], "expected prefixes to match nested fields")
+	assertions.Len(update["$set"], 4)
+}
+
+func TestBuildUpdate_Operators(t *testing.T) {
+	var assertions = assert.New(t)
+	var modified = time.Date(2024, 1, 3, 6, 10, 35, 0, time.UTC)
+	var mongoConfig = &config.Mongo{
+		SetOnInsert: []string{"event.type", "subscriptionId"},
+		Operators: []config.MongoOperator{
+			{Field: "retries", Operator: mongo.OperatorInc, Statuses: []string{"failed"}},
+			{Field: "firstSeen", Operator: mongo.OperatorMin, From: "modified"},
+			{Field: "lastSeen", Operator: mongo.OperatorMax, From: "modified"},
+			{Field: "modified", Operator: mongo.OperatorMax, From: "modified"},
+			{Field: "deliveredAt", Operator: mongo.OperatorMax, From: "deliveredAt"},
+		},
+	}
+	var document = map[string]any{
+		"status":         "FAILED",
+		"modified":       modified,
+		"event.type":     "vortex.test.event",
+		"subscriptionId": "1",
+	}
+
+	var update, err = mongo.BuildUpdate(mongoConfig, "MESSAGE", document)
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(bson.M{
+		"$set":         bson.M{"status": "FAILED"},
+		"$setOnInsert": bson.M{"event.type": "vortex.test.event", "subscriptionId": "1"},
+		"$inc":         bson.M{"retries": 1},
+		"$min":         bson.M{"firstSeen": modified},
+		"$max":         bson.M{"lastSeen": modified, "modified": modified},
+	}, update, "expected fields updated by operators to be neither set nor written on insert")
+
+	document["status"] = "DELIVERED"
+	update, err = mongo.BuildUpdate(mongoConfig, "MESSAGE", document)
+	assertions.Nil(err, "expected no error")
+	assertions.NotContains(update, "$inc", "expected operators to only apply to their statuses")
+
+	mongoConfig = &config.Mongo{Operators: []config.MongoOperator{{Field: "deliveredAt", Operator: mongo.OperatorMax, From: "event.times[-1]"}}}
+	update, err = mongo.BuildUpdate(mongoConfig, "MESSAGE", map[string]any{"event": map[string]any{"times": []any{1, 2}}})
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(bson.M{"deliveredAt": 2}, update["$max"], "expected the source field to be resolved as a path")
+}
+
+func TestBuildUpdate_Retention(t *testing.T) {
+	var assertions = assert.New(t)
+	var mongoConfig = &config.Mongo{
+		Updates:   []config.MongoUpdate{metadataUpdate},
+		Retention: config.MongoRetention{Enabled: true, Field: "expireAt"},
+	}
+
+	var update, err = mongo.BuildUpdate(mongoConfig, "METADATA", map[string]any{"status": "FAILED", "expireAt": 1})
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(bson.M{"$set": bson.M{"status": "FAILED"}, "$setOnInsert": bson.M{"_placeholder": true, "expireAt": 1}}, update, "expected the expiry to be written on insert only")
+
+	mongoConfig.Updates = []config.MongoUpdate{{Type: "METADATA", Set: []string{"status", "expireAt"}}}
+	update, err = mongo.BuildUpdate(mongoConfig, "METADATA", map[string]any{"status": "FAILED", "expireAt": 1})
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(bson.M{"$set": bson.M{"status": "FAILED", "expireAt": 1}, "$setOnInsert": bson.M{"_placeholder": true}}, update, "expected the expiry to be updated if it is set")
+}
+
+func TestBuildUpdate_Invalid(t *testing.T) {
+	var cases = map[string]*config.Mongo{
+		"missing type":           {Updates: []config.MongoUpdate{{Set: []string{"status"}}}},
+		"duplicate type":         {Updates: []config.MongoUpdate{metadataUpdate, metadataUpdate}},
+		"conflicting set":        {Updates: []config.MongoUpdate{{Type: "METADATA", Set: []string{"event.type"}, SetOnInsert: []string{"event"}}}},
+		"global conflicting set": {Updates: []config.MongoUpdate{metadataUpdate}, SetOnInsert: []string{"status"}},
+		"unknown operator":       {Operators: []config.MongoOperator{{Field: "retries", Operator: "mul"}}},
+		"missing field":          {Operators: []config.MongoOperator{{Operator: mongo.OperatorInc}}},
+		"max without value":      {Operators: []config.MongoOperator{{Field: "lastSeen", Operator: mongo.OperatorMax}}},
+		"source and value":       {Operators: []config.MongoOperator{{Field: "lastSeen", Operator: mongo.OperatorMax, From: "modified", Value: 1}}},
+		"duplicate operator":     {Operators: []config.MongoOperator{{Field: "retries", Operator: mongo.OperatorInc}, {Field: "retries", Operator: mongo.OperatorInc}}},
+		"operator on insert":     {SetOnInsert: []string{"retries"}, Operators: []config.MongoOperator{{Field: "retries", Operator: mongo.OperatorInc}}},
+		"invalid source":         {Operators: []config.MongoOperator{{Field: "lastSeen", Operator: mongo.OperatorMax, From: "items[x]"}}},
+		"operator on expiry":     {Retention: config.MongoRetention{Enabled: true, Field: "expireAt"}, Operators: []config.MongoOperator{{Field: "expireAt", Operator: mongo.OperatorMax, From: "modified"}}},
+		"expiry on insert":       {Retention: config.MongoRetention{Enabled: true, Field: "expireAt"}, SetOnInsert: []string{"expireAt"}},
+		"type expiry on insert":  {Retention: config.MongoRetention{Enabled: true, Field: "expireAt"}, Updates: []config.MongoUpdate{{Type: "METADATA", SetOnInsert: []string{"expireAt"}}}},
+	}
+
+	for name, mongoConfig := range cases {
+		t.Run(name, func(t *testing.T) {
+			var _, err = mongo.BuildUpdate(mongoConfig, "METADATA", map[string]any{})
+			assert.NotNil(t, err, "expected an error")
+		})
+	}
+}
@@ -0,0 +1,405 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package status decodes Horizon status messages into typed structs and applies the default transformations on
+// them, which is considerably cheaper than decoding into maps and transforming those. Payloads whose result could
+// differ from the default transformations are rejected with ErrUnsupported, so that callers fall back to the
+// generic path.
+package status
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrUnsupported is returned if a payload cannot be decoded into a Message without changing the result.
+var ErrUnsupported = errors.New("unsupported status message")
+
+const (
+	hasStatus = 1 << iota
+	hasSubscriptionId
+	hasDeliveryType
+	hasEnvironment
+	hasEventRetentionTime
+	hasMultiplexedFrom
+	hasEventType
+	hasEventTime
+	hasEvent
+	hasEventId
+	hasProperties
+	hasHttpHeaders
+)
+
+// Event is the CloudEvent of a status message. Its data and the fields dropped by the default transformations
+// are skipped while decoding.
+type Event struct {
+	Id    string
+	Type  string
+	Time  string
+	Extra map[string]any
+}
+
+// Message is a Horizon status message. The additionalFields of the payload are decoded as Properties, whereas only
+// the HTTP headers copied to the properties or needed for tracing are kept. Unknown fields end up in Extra.
+type Message struct {
+	Event              Event
+	Status             string
+	SubscriptionId     string
+	DeliveryType       string
+	Environment        string
+	EventRetentionTime string
+	MultiplexedFrom    string
+	Properties         map[string]any
+	BusinessContext    []string
+	CorrelationId      []string
+	TraceHeaders       map[string]any
+	Extra              map[string]any
+
+	present int
+}
+
+// reservedFields are written by the default transformations or the sink, so payloads containing them are unsupported.
+var reservedFields = []string{"properties", "topic", "modified", "timestamp"}
+
+// Decode decodes a status message. ErrUnsupported is returned for payloads that have to be decoded generically,
+// e.g. because they lack an event id, contain unexpected types or keys containing dots, or contain one of the given
+// fields reserved by the sink.
+func Decode(data []byte, reserved ...string) (*Message, error) {
+	var message = new(Message)
+	var decoder = json.NewDecoder(bytes.NewReader(data))
+
+	var err = decodeObject(decoder, func(key string) error {
+		switch key {
+
+		case "event":
+			if err := message.markObject(hasEvent); err != nil {
+				return err
+			}
+			return decodeObject(decoder, func(key string) error {
+				return message.decodeEventField(decoder, key)
+			})
+
+		case "additionalFields":
+			if err := message.markObject(hasProperties); err != nil {
+				return err
+			}
+			if err := decoder.Decode(&message.Properties); err != nil {
+				return err
+			}
+			if message.Properties == nil || hasDottedKeys(message.Properties) {
+				return ErrUnsupported
+			}
+			return nil
+
+		case "httpHeaders":
+			if err := message.markObject(hasHttpHeaders); err != nil {
+				return err
+			}
+			return message.decodeHeaders(decoder)
+
+		case "status":
+			return message.decodeString(decoder, &message.Status, hasStatus)
+		case "subscriptionId":
+			return message.decodeString(decoder, &message.SubscriptionId, hasSubscriptionId)
+		case "deliveryType":
+			return message.decodeString(decoder, &message.DeliveryType, hasDeliveryType)
+		case "environment":
+			return message.decodeString(decoder, &message.Environment, hasEnvironment)
+		case "eventRetentionTime":
+			return message.decodeString(decoder, &message.EventRetentionTime, hasEventRetentionTime)
+		case "multiplexedFrom":
+			return message.decodeString(decoder, &message.MultiplexedFrom, hasMultiplexedFrom)
+
+		case "uuid", "_id":
+			return decoder.Decode(&skipped{})
+
+		default:
+			if slices.Contains(reservedFields, key) || slices.Contains(reserved, key) {
+				return ErrUnsupported
+			}
+			return decodeExtra(decoder, key, &message.Extra)
+
+		}
+	})
+
+	if err == nil {
+		if _, trailing := decoder.Token(); trailing != io.EOF {
+			err = errors.New("unexpected data after the message")
+		}
+	}
+
+	if err != nil {
+		if errors.Is(err, ErrUnsupported) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %w", ErrUnsupported, err)
+	}
+
+	if !message.has(hasEvent) || !message.has(hasEventId) {
+		return nil, ErrUnsupported
+	}
+	return message, nil
+}
+
+func (m *Message) decodeEventField(decoder *json.Decoder, key string) error {
+	switch key {
+
+	case "id":
+		return m.decodeString(decoder, &m.Event.Id, hasEventId)
+	case "type":
+		return m.decodeString(decoder, &m.Event.Type, hasEventType)
+	case "time":
+		return m.decodeString(decoder, &m.Event.Time, hasEventTime)
+
+	case "data", "source", "specversion", "datacontenttype", "dataref":
+		return decoder.Decode(&skipped{})
+
+	case "_id":
+		return ErrUnsupported
+
+	default:
+		return decodeExtra(decoder, key, &m.Event.Extra)
+
+	}
+}
+
+// httpHeaders are the HTTP headers copied to the properties or needed for tracing. Decoding them into a struct
+// skips all other headers without allocating their keys.
+type httpHeaders struct {
+	BusinessContext []string `json:"x-business-context"`
+	CorrelationId   []string `json:"x-correlation-id"`
+	B3              []any    `json:"b3"`
+	B3TraceId       []any    `json:"x-b3-traceid"`
+	B3SpanId        []any    `json:"x-b3-spanid"`
+	B3ParentSpanId  []any    `json:"x-b3-parentspanid"`
+	B3Sampled       []any    `json:"x-b3-sampled"`
+	TraceParent     []any    `json:"traceparent"`
+	TraceState      []any    `json:"tracestate"`
+}
+
+func (m *Message) decodeHeaders(decoder *json.Decoder) error {
+	var headers httpHeaders
+	if err := decoder.Decode(&headers); err != nil {
+		return err
+	}
+
+	m.BusinessContext = headers.BusinessContext
+	m.CorrelationId = headers.CorrelationId
+
+	m.addTraceHeader("b3", headers.B3)
+	m.addTraceHeader("x-b3-traceid", headers.B3TraceId)
+	m.addTraceHeader("x-b3-spanid", headers.B3SpanId)
+	m.addTraceHeader("x-b3-parentspanid", headers.B3ParentSpanId)
+	m.addTraceHeader("x-b3-sampled", headers.B3Sampled)
+	m.addTraceHeader("traceparent", headers.TraceParent)
+	m.addTraceHeader("tracestate", headers.TraceState)
+	return nil
+}
+
+func (m *Message) addTraceHeader(key string, values []any) {
+	if values == nil {
+		return
+	}
+	if m.TraceHeaders == nil {
+		m.TraceHeaders = make(map[string]any)
+	}
+	m.TraceHeaders[key] = values
+}
+
+func (m *Message) decodeString(decoder *json.Decoder, target *string, field int) error {
+	m.present |= field
+	return decoder.Decode((*text)(target))
+}
+
+// markObject marks an object as present. Objects occurring twice are unsupported, since they would be merged
+// instead of replaced.
+func (m *Message) markObject(field int) error {
+	if m.has(field) {
+		return ErrUnsupported
+	}
+	m.present |= field
+	return nil
+}
+
+func (m *Message) has(field int) bool {
+	return m.present&field != 0
+}
+
+// TracingFields returns the fields of the payload a trace context may be extracted from, in the shape of the
+// generic document.
+func (m *Message) TracingFields() map[string]any {
+	var fields = make(map[string]any, 2)
+	if m.Properties != nil {
+		fields["additionalFields"] = m.Properties
+	}
+	if m.TraceHeaders != nil {
+		fields["httpHeaders"] = m.TraceHeaders
+	}
+	return fields
+}
+
+// Document applies the default transformations and returns the flattened document, which equals the result of
+// the default registry for the same payload plus the topic.
+func (m *Message) Document(topic string, now time.Time) bson.D {
+	var document = make(bson.D, 0, 14+len(m.Event.Extra)+len(m.Properties)+len(m.Extra))
+
+	document = append(document, bson.E{Key: "event._id", Value: m.Event.Id}, bson.E{Key: "event.id", Value: m.Event.Id})
+	document = m.appendString(document, "event.type", m.Event.Type, hasEventType)
+	document = m.appendString(document, "event.time", m.Event.Time, hasEventTime)
+	for key, value := range m.Event.Extra {
+		document = appendFlat(document, "event."+key, value)
+	}
+
+	document = m.appendString(document, "status", m.Status, hasStatus)
+	document = m.appendString(document, "subscriptionId", m.SubscriptionId, hasSubscriptionId)
+	document = m.appendString(document, "deliveryType", m.DeliveryType, hasDeliveryType)
+	document = m.appendString(document, "environment", m.Environment, hasEnvironment)
+	document = m.appendString(document, "eventRetentionTime", m.EventRetentionTime, hasEventRetentionTime)
+	document = m.appendString(document, "multiplexedFrom", m.MultiplexedFrom, hasMultiplexedFrom)
+
+	if m.Properties != nil {
+		for key, value := range m.Properties {
+			document = appendFlat(document, "properties."+key, value)
+		}
+		if len(m.BusinessContext) > 0 {
+			document = SetElement(document, "properties.x-business-context", strings.Join(m.BusinessContext, ","))
+		}
+		if len(m.CorrelationId) > 0 {
+			document = SetElement(document, "properties.x-correlation-id", strings.Join(m.CorrelationId, ","))
+		}
+	}
+
+	for key, value := range m.Extra {
+		document = appendFlat(document, key, value)
+	}
+
+	document = append(document, bson.E{Key: "topic", Value: topic}, bson.E{Key: "modified", Value: now})
+	if m.has(hasStatus) && m.Status == "DROPPED" {
+		document = append(document, bson.E{Key: "timestamp", Value: now})
+	}
+	return document
+}
+
+func (m *Message) appendString(document bson.D, key string, value string, field int) bson.D {
+	if !m.has(field) {
+		return document
+	}
+	return append(document, bson.E{Key: key, Value: value})
+}
+
+// appendFlat appends a value like utils.Flatten does with the default options: objects are merged into the keys
+// and vanish if they are empty, whereas arrays are kept.
+func appendFlat(document bson.D, key string, value any) bson.D {
+	var object, ok = value.(map[string]any)
+	if !ok {
+		return append(document, bson.E{Key: key, Value: value})
+	}
+
+	for subKey, subValue := range object {
+		document = appendFlat(document, key+"."+subKey, subValue)
+	}
+	return document
+}
+
+// SetElement replaces the value of the given key or appends it if it does not exist yet.
+func SetElement(document bson.D, key string, value any) bson.D {
+	for i := range document {
+		if document[i].Key == key {
+			document[i].Value = value
+			return document
+		}
+	}
+	return append(document, bson.E{Key: key, Value: value})
+}
+
+// decodeObject calls decodeField for each key of the next JSON object, which has to decode the value.
+func decodeObject(decoder *json.Decoder, decodeField func(key string) error) error {
+	var token, err = decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != json.Delim('{') {
+		return ErrUnsupported
+	}
+
+	for decoder.More() {
+		if token, err = decoder.Token(); err != nil {
+			return err
+		}
+		if err := decodeField(token.(string)); err != nil {
+			return err
+		}
+	}
+
+	_, err = decoder.Token()
+	return err
+}
+
+func decodeExtra(decoder *json.Decoder, key string, extra *map[string]any) error {
+	if strings.Contains(key, ".") {
+		return ErrUnsupported
+	}
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+	if object, ok := value.(map[string]any); ok && hasDottedKeys(object) {
+		return ErrUnsupported
+	}
+
+	if *extra == nil {
+		*extra = make(map[string]any)
+	}
+	(*extra)[key] = value
+	return nil
+}
+
+// hasDottedKeys reports whether an object contains keys with dots at any level, which could collide once flattened.
+func hasDottedKeys(object map[string]any) bool {
+	for key, value := range object {
+		if strings.Contains(key, ".") {
+			return true
+		}
+		if nested, ok := value.(map[string]any); ok && hasDottedKeys(nested) {
+			return true
+		}
+	}
+	return false
+}
+
+// text is a string that must not be null, since null would leave the target unchanged.
+type text string
+
+func (t *text) UnmarshalJSON(data []byte) error {
+	if len(data) < 2 || data[0] != '"' {
+		return ErrUnsupported
+	}
+
+	if bytes.IndexByte(data, '\\') < 0 {
+		*t = text(data[1 : len(data)-1])
+		return nil
+	}
+
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*t = text(value)
+	return nil
+}
+
+// skipped discards a value without allocating it.
+type skipped struct{}
+
+func (*skipped) UnmarshalJSON([]byte) error {
+	return nil
+}
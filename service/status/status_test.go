@@ -0,0 +1,172 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package status_test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"os"
+	"testing"
+	"time"
+	"vortex/service/status"
+	"vortex/service/transforms"
+	"vortex/service/utils"
+)
+
+var defaultRegistry = transforms.NewDefaultRegistry(utils.DefaultFlattenOptions())
+
+func TestDocument_EqualsDefaultTransforms(t *testing.T) {
+	for _, file := range []string{"../../testdata/kafka_msg.json", "../../testdata/kafka_dropped_msg.json"} {
+		t.Run(file, func(t *testing.T) {
+			var assertions = assert.New(t)
+			var payload = mustReadFile(file)
+
+			var expected, err = genericDocument(payload, "status")
+			assertions.Nil(err, "expected no error")
+
+			decoded, err := status.Decode(payload)
+			assertions.Nil(err, "expected no error")
+
+			var actual = decoded.Document("status", time.Now().UTC()).Map()
+			for _, field := range []string{"modified", "timestamp"} {
+				_, expectedOk := expected[field]
+				_, actualOk := actual[field]
+				assertions.Equal(expectedOk, actualOk, "expected field '%s' to be present in both documents", field)
+				delete(expected, field)
+				delete(actual, field)
+			}
+
+			assertions.Equal(expected, map[string]any(actual))
+		})
+	}
+}
+
+func TestDocument_UnknownFields(t *testing.T) {
+	var assertions = assert.New(t)
+	var payload = []byte(`{"event": {"id": "1", "extension": {"a": 1, "b": {}}}, "custom": [1, 2], "nested": {"c": "d"}}`)
+
+	var expected, err = genericDocument(payload, "status")
+	assertions.Nil(err, "expected no error")
+
+	decoded, err := status.Decode(payload)
+	assertions.Nil(err, "expected no error")
+
+	var actual = decoded.Document("status", time.Now().UTC()).Map()
+	delete(expected, "modified")
+	delete(actual, "modified")
+	assertions.Equal(expected, map[string]any(actual))
+}
+
+func TestDecode_TracingFields(t *testing.T) {
+	var assertions = assert.New(t)
+
+	decoded, err := status.Decode(mustReadFile("../../testdata/kafka_msg.json"))
+	assertions.Nil(err, "expected no error")
+
+	var fields = decoded.TracingFields()
+	var additionalFields = fields["additionalFields"].(map[string]any)
+	assertions.Equal("5847073714cf4139ea5cb9c23c60b3f9", additionalFields["X-B3-TraceId"])
+
+	var httpHeaders = fields["httpHeaders"].(map[string]any)
+	assertions.Equal([]any{"5847073714cf4139ea5cb9c23c60b3f9"}, httpHeaders["x-b3-traceid"])
+	_, ok := httpHeaders["user-agent"]
+	assertions.False(ok, "expected unrelated headers to be skipped")
+}
+
+func TestDecode_Unsupported(t *testing.T) {
+	var cases = map[string]string{
+		"missing event":     `{"status": "PROCESSED"}`,
+		"missing event id":  `{"event": {"type": "test"}}`,
+		"null event id":     `{"event": {"id": null}}`,
+		"numeric status":    `{"event": {"id": "1"}, "status": 1}`,
+		"reserved field":    `{"event": {"id": "1"}, "properties": {}}`,
+		"sink field":        `{"event": {"id": "1"}, "coordinates": {"partition": 1}}`,
+		"expiry field":      `{"event": {"id": "1"}, "expireAt": "2024-01-03T06:10:35Z"}`,
+		"dotted key":        `{"event": {"id": "1"}, "a.b": 1}`,
+		"nested dotted key": `{"event": {"id": "1"}, "additionalFields": {"a": {"b.c": 1}}}`,
+		"duplicate object":  `{"event": {"id": "1"}, "event": {"id": "2"}}`,
+		"trailing data":     `{"event": {"id": "1"}} {}`,
+		"invalid json":      `{"event": {"id": "1"`,
+	}
+
+	for name, payload := range cases {
+		t.Run(name, func(t *testing.T) {
+			var _, err = status.Decode([]byte(payload), "coordinates", "expireAt")
+			assert.True(t, errors.Is(err, status.ErrUnsupported), "expected payload to be unsupported")
+		})
+	}
+
+	var _, err = status.Decode([]byte(`{"event": {"id": "1"}, "expireAt": "2024-01-03T06:10:35Z"}`))
+	assert.Nil(t, err, "expected fields to be reserved by the sink only")
+}
+
+func TestSetElement(t *testing.T) {
+	var assertions = assert.New(t)
+	var document = bson.D{{Key: "a", Value: 1}}
+
+	document = status.SetElement(document, "a", 2)
+	document = status.SetElement(document, "b", 3)
+	assertions.Equal(bson.D{{Key: "a", Value: 2}, {Key: "b", Value: 3}}, document)
+}
+
+// BenchmarkGenericDecoding measures the generic path: decoding into a map, applying the default registry and
+// encoding the update.
+func BenchmarkGenericDecoding(b *testing.B) {
+	var payload = mustReadFile("../../testdata/kafka_msg.json")
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var document, err = genericDocument(payload, "status")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := bson.Marshal(bson.M{"$set": document}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkTypedDecoding measures the typed path: decoding into a Message, transforming it and encoding the update.
+func BenchmarkTypedDecoding(b *testing.B) {
+	var payload = mustReadFile("../../testdata/kafka_msg.json")
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var decoded, err = status.Decode(payload)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := bson.Marshal(bson.M{"$set": decoded.Document("status", time.Now().UTC())}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// genericDocument applies the default transformations like the sink does without typed decoding.
+func genericDocument(payload []byte, topic string) (map[string]any, error) {
+	var document map[string]any
+	if err := json.Unmarshal(payload, &document); err != nil {
+		return nil, err
+	}
+	delete(document, "_id")
+	document["topic"] = topic
+
+	return defaultRegistry.ApplyTransforms(document)
+}
+
+func mustReadFile(filename string) []byte {
+	bytes, err := os.ReadFile(filename)
+	if err != nil {
+		panic(err)
+	}
+	return bytes
+}
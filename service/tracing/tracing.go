@@ -0,0 +1,176 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"vortex/service/config"
+)
+
+const TracerName = "vortex"
+
+var propagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)),
+)
+
+var provider *sdktrace.TracerProvider
+
+// Init configures the global tracer provider to export spans via OTLP. If tracing is disabled, the no-op
+// provider of OpenTelemetry stays in place, so that creating spans remains cheap.
+func Init(config *config.Tracing) error {
+	if !config.Enabled {
+		return nil
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(config.Endpoint))
+	if err != nil {
+		return err
+	}
+
+	serviceResource, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(config.ServiceName),
+	))
+	if err != nil {
+		return err
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(serviceResource),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SamplingRatio))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+	log.Info().Msgf("Exporting traces to %s", config.Endpoint)
+	return nil
+}
+
+// Shutdown flushes all pending spans.
+func Shutdown() {
+	if provider == nil {
+		return
+	}
+
+	if err := provider.Shutdown(context.Background()); err != nil {
+		log.Error().Err(err).Msg("Could not shutdown tracer provider")
+	}
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// Extract returns a context carrying the parent span of a message. The record headers are taken into account first,
+// followed by the B3 fields Horizon stores in the additionalFields and httpHeaders of the payload.
+func Extract(message *sarama.ConsumerMessage, document map[string]any) context.Context {
+	var ctx = propagator.Extract(context.Background(), HeaderCarrier(message.Headers))
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+
+	if additionalFields, ok := document["additionalFields"].(map[string]any); ok {
+		ctx = propagator.Extract(context.Background(), newPayloadCarrier(additionalFields))
+		if trace.SpanContextFromContext(ctx).IsValid() {
+			return ctx
+		}
+	}
+
+	if httpHeaders, ok := document["httpHeaders"].(map[string]any); ok {
+		ctx = propagator.Extract(context.Background(), newPayloadCarrier(httpHeaders))
+	}
+	return ctx
+}
+
+// HeaderCarrier adapts Kafka record headers to a propagation.TextMapCarrier.
+type HeaderCarrier []*sarama.RecordHeader
+
+func (c HeaderCarrier) Get(key string) string {
+	for _, header := range c {
+		if strings.EqualFold(string(header.Key), key) {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// Set is not supported, since consumed headers are never modified.
+func (c HeaderCarrier) Set(string, string) {}
+
+func (c HeaderCarrier) Keys() []string {
+	var keys = make([]string, len(c))
+	for i, header := range c {
+		keys[i] = string(header.Key)
+	}
+	return keys
+}
+
+// newPayloadCarrier creates a carrier from a map of the payload with case-insensitive keys.
+// Values may either be strings or lists of strings, as found in httpHeaders.
+func newPayloadCarrier(fields map[string]any) propagation.MapCarrier {
+	var carrier = make(propagation.MapCarrier, len(fields))
+	for key, value := range fields {
+		switch casted := value.(type) {
+
+		case string:
+			carrier[strings.ToLower(key)] = casted
+
+		case []any:
+			if len(casted) > 0 {
+				if first, ok := casted[0].(string); ok {
+					carrier[strings.ToLower(key)] = first
+				}
+			}
+
+		}
+	}
+	return carrier
+}
+
+// StartConsume starts the span covering a message from its consumption until it has been persisted.
+func StartConsume(message *sarama.ConsumerMessage, document map[string]any) (context.Context, trace.Span) {
+	return Tracer().Start(Extract(message, document), "consume",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingDestinationName(message.Topic),
+			semconv.MessagingKafkaDestinationPartition(int(message.Partition)),
+			semconv.MessagingKafkaMessageOffset(int(message.Offset)),
+			semconv.MessagingKafkaMessageKey(string(message.Key)),
+		),
+	)
+}
+
+// StartBulkWrite starts the span of a bulk-write, which is linked to the spans of all messages it contains.
+func StartBulkWrite(collection string, messageSpans []trace.Span) trace.Span {
+	var links = make([]trace.Link, len(messageSpans))
+	for i, span := range messageSpans {
+		links[i] = trace.Link{SpanContext: span.SpanContext()}
+	}
+
+	var _, span = Tracer().Start(context.Background(), "bulk-write",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			semconv.DBSystemMongoDB,
+			semconv.DBMongoDBCollection(collection),
+			semconv.MessagingBatchMessageCount(len(messageSpans)),
+		),
+	)
+	return span
+}
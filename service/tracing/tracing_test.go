@@ -0,0 +1,66 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing_test
+
+import (
+	"encoding/json"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+	"testing"
+	"vortex/service/tracing"
+)
+
+func TestExtract_Headers(t *testing.T) {
+	var assertions = assert.New(t)
+	var message = &sarama.ConsumerMessage{
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("traceparent"), Value: []byte("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")},
+		},
+	}
+
+	var spanContext = trace.SpanContextFromContext(tracing.Extract(message, mustReadJson("../../testdata/kafka_msg.json")))
+	assertions.True(spanContext.IsValid(), "expected span context to be valid")
+	assertions.Equal("4bf92f3577b34da6a3ce929d0e0e4736", spanContext.TraceID().String(), "expected headers to take precedence")
+	assertions.Equal("00f067aa0ba902b7", spanContext.SpanID().String())
+}
+
+func TestExtract_Payload(t *testing.T) {
+	var assertions = assert.New(t)
+	var message = &sarama.ConsumerMessage{}
+
+	var spanContext = trace.SpanContextFromContext(tracing.Extract(message, mustReadJson("../../testdata/kafka_msg.json")))
+	assertions.True(spanContext.IsValid(), "expected span context to be valid")
+	assertions.Equal("5847073714cf4139ea5cb9c23c60b3f9", spanContext.TraceID().String())
+	assertions.Equal("9bba7ccc5a2255a4", spanContext.SpanID().String(), "expected additionalFields to take precedence")
+	assertions.True(spanContext.IsSampled())
+}
+
+func TestExtract_HttpHeaders(t *testing.T) {
+	var assertions = assert.New(t)
+	var message = &sarama.ConsumerMessage{}
+	var document = mustReadJson("../../testdata/kafka_msg.json")
+	delete(document, "additionalFields")
+
+	var spanContext = trace.SpanContextFromContext(tracing.Extract(message, document))
+	assertions.True(spanContext.IsValid(), "expected span context to be valid")
+	assertions.Equal("5847073714cf4139ea5cb9c23c60b3f9", spanContext.TraceID().String())
+	assertions.Equal("60c10dd5e7ebddc8", spanContext.SpanID().String())
+}
+
+func mustReadJson(filename string) map[string]any {
+	bytes, err := os.ReadFile(filename)
+	if err != nil {
+		panic(err)
+	}
+
+	var data = make(map[string]any)
+	if err := json.Unmarshal(bytes, &data); err != nil {
+		panic(err)
+	}
+
+	return data
+}
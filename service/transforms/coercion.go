@@ -0,0 +1,248 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package transforms
+
+import (
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"vortex/service/utils"
+)
+
+const (
+	CoerceDate    = "date"
+	CoerceInt     = "int"
+	CoerceDecimal = "decimal"
+	CoerceBool    = "bool"
+)
+
+const (
+	FormatRFC3339      = "rfc3339"
+	FormatRFC3339Nano  = "rfc3339nano"
+	FormatEpochSeconds = "epochSeconds"
+	FormatEpochMillis  = "epochMillis"
+)
+
+const (
+	OnFailureLeave = "leave"
+	OnFailureDrop  = "drop"
+	OnFailureError = "error"
+)
+
+// Coercion describes the type the value at a path is converted to. Format only applies to dates: without a format,
+// strings are parsed as RFC3339 timestamps (with optional fractional seconds) and numbers as epoch milliseconds.
+// OnFailure decides whether values that cannot be converted are left as they are (default), dropped or fail the message.
+type Coercion struct {
+	Path      *utils.Path
+	Type      string
+	Format    string
+	OnFailure string
+}
+
+// Coerce converts the values at the given paths to BSON dates, integers, decimals or booleans.
+// Missing and null values are ignored.
+func Coerce(coercions ...Coercion) TransformFunc {
+	return func(data map[string]any) (map[string]any, error) {
+		for _, coercion := range coercions {
+			for _, match := range coercion.Path.Find(data) {
+				var value = match.Value()
+				if value == nil {
+					continue
+				}
+
+				var coerced, err = coercion.convert(value)
+				if err == nil {
+					match.Set(coerced)
+					continue
+				}
+
+				switch coercion.OnFailure {
+
+				case OnFailureDrop:
+					match.Delete()
+
+				case OnFailureError:
+					return nil, fmt.Errorf("could not coerce '%s' to %s: %w", coercion.Path, coercion.Type, err)
+
+				}
+			}
+		}
+		return data, nil
+	}
+}
+
+// Validate returns an error if the type, format or failure policy of the coercion is unknown.
+func (c Coercion) Validate() error {
+	switch c.Type {
+	case CoerceDate:
+		switch c.Format {
+		case "", FormatRFC3339, FormatRFC3339Nano, FormatEpochSeconds, FormatEpochMillis:
+		default:
+			return errors.New(fmt.Sprintf("unknown date format '%s' of field '%s'", c.Format, c.Path))
+		}
+	case CoerceInt, CoerceDecimal, CoerceBool:
+	default:
+		return errors.New(fmt.Sprintf("unknown type '%s' of field '%s'", c.Type, c.Path))
+	}
+
+	switch c.OnFailure {
+	case "", OnFailureLeave, OnFailureDrop, OnFailureError:
+	default:
+		return errors.New(fmt.Sprintf("unknown failure policy '%s' of field '%s'", c.OnFailure, c.Path))
+	}
+	return nil
+}
+
+func (c Coercion) convert(value any) (any, error) {
+	switch c.Type {
+
+	case CoerceDate:
+		return toDate(value, c.Format)
+
+	case CoerceInt:
+		return toInt(value)
+
+	case CoerceDecimal:
+		return toDecimal(value)
+
+	case CoerceBool:
+		return toBool(value)
+
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown type '%s'", c.Type))
+
+	}
+}
+
+func toDate(value any, format string) (time.Time, error) {
+	if parsed, ok := value.(time.Time); ok {
+		return parsed.UTC(), nil
+	}
+
+	switch format {
+
+	case FormatRFC3339, FormatRFC3339Nano:
+		// RFC3339Nano accepts timestamps with and without fractional seconds when parsing
+		var timeString, ok = value.(string)
+		if !ok {
+			return time.Time{}, errors.New(fmt.Sprintf("expected a string but got %T", value))
+		}
+		return parseTimestamp(timeString)
+
+	case FormatEpochSeconds:
+		var seconds, err = toInt(value)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+
+	case FormatEpochMillis:
+		var millis, err = toInt(value)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.UnixMilli(millis).UTC(), nil
+
+	default:
+		if timeString, ok := value.(string); ok {
+			if _, err := strconv.ParseInt(strings.TrimSpace(timeString), 10, 64); err != nil {
+				return parseTimestamp(timeString)
+			}
+		}
+		return toDate(value, FormatEpochMillis)
+
+	}
+}
+
+func parseTimestamp(value string) (time.Time, error) {
+	var parsed, err = time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, errors.New(fmt.Sprintf("'%s' is not an RFC3339 timestamp", value))
+	}
+	return parsed.UTC(), nil
+}
+
+func toInt(value any) (int64, error) {
+	switch casted := value.(type) {
+
+	case int:
+		return int64(casted), nil
+
+	case int32:
+		return int64(casted), nil
+
+	case int64:
+		return casted, nil
+
+	case float64:
+		if casted != math.Trunc(casted) || casted > math.MaxInt64 || casted < math.MinInt64 {
+			return 0, errors.New(fmt.Sprintf("%v is not an integer", casted))
+		}
+		return int64(casted), nil
+
+	case string:
+		var parsed, err = strconv.ParseInt(strings.TrimSpace(casted), 10, 64)
+		if err != nil {
+			return 0, errors.New(fmt.Sprintf("'%s' is not an integer", casted))
+		}
+		return parsed, nil
+
+	default:
+		return 0, errors.New(fmt.Sprintf("expected a number or string but got %T", value))
+
+	}
+}
+
+func toDecimal(value any) (primitive.Decimal128, error) {
+	var decimalString string
+	switch casted := value.(type) {
+
+	case primitive.Decimal128:
+		return casted, nil
+
+	case int, int32, int64:
+		decimalString = fmt.Sprint(casted)
+
+	case float64:
+		decimalString = strconv.FormatFloat(casted, 'f', -1, 64)
+
+	case string:
+		decimalString = strings.TrimSpace(casted)
+
+	default:
+		return primitive.Decimal128{}, errors.New(fmt.Sprintf("expected a number or string but got %T", value))
+
+	}
+
+	var parsed, err = primitive.ParseDecimal128(decimalString)
+	if err != nil {
+		return primitive.Decimal128{}, errors.New(fmt.Sprintf("'%s' is not a decimal", decimalString))
+	}
+	return parsed, nil
+}
+
+func toBool(value any) (bool, error) {
+	switch casted := value.(type) {
+
+	case bool:
+		return casted, nil
+
+	case float64:
+		if casted == 0 || casted == 1 {
+			return casted == 1, nil
+		}
+
+	case string:
+		if parsed, err := strconv.ParseBool(strings.TrimSpace(casted)); err == nil {
+			return parsed, nil
+		}
+
+	}
+	return false, errors.New(fmt.Sprintf("%v is not a boolean", value))
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package transforms_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+	"time"
+	"vortex/service/config"
+	"vortex/service/transforms"
+	"vortex/service/utils"
+)
+
+func TestCoerce(t *testing.T) {
+	var assertions = assert.New(t)
+	var transformFunc = transforms.Coerce(
+		transforms.Coercion{Path: utils.MustParsePath("rfc3339"), Type: transforms.CoerceDate, Format: transforms.FormatRFC3339},
+		transforms.Coercion{Path: utils.MustParsePath("rfc3339nano"), Type: transforms.CoerceDate},
+		transforms.Coercion{Path: utils.MustParsePath("seconds"), Type: transforms.CoerceDate, Format: transforms.FormatEpochSeconds},
+		transforms.Coercion{Path: utils.MustParsePath("millis"), Type: transforms.CoerceDate},
+		transforms.Coercion{Path: utils.MustParsePath("millisString"), Type: transforms.CoerceDate},
+		transforms.Coercion{Path: utils.MustParsePath("int"), Type: transforms.CoerceInt},
+		transforms.Coercion{Path: utils.MustParsePath("decimal"), Type: transforms.CoerceDecimal},
+		transforms.Coercion{Path: utils.MustParsePath("bool"), Type: transforms.CoerceBool},
+		transforms.Coercion{Path: utils.MustParsePath("missing"), Type: transforms.CoerceBool, OnFailure: transforms.OnFailureError},
+	)
+
+	transformed, err := transformFunc(map[string]any{
+		"rfc3339":      "2024-01-03T07:10:35+01:00",
+		"rfc3339nano":  "2024-01-03T06:10:35.592Z",
+		"seconds":      float64(1704262235),
+		"millis":       float64(1704262235592),
+		"millisString": "1704262235592",
+		"int":          "42",
+		"decimal":      "19.99",
+		"bool":         "true",
+	})
+	assertions.Nil(err, "expected no error")
+
+	var expected = time.Date(2024, 1, 3, 6, 10, 35, 0, time.UTC)
+	var expectedMillis = expected.Add(592 * time.Millisecond)
+	assertions.Equal(expected, transformed["rfc3339"])
+	assertions.Equal(expectedMillis, transformed["rfc3339nano"])
+	assertions.Equal(expected, transformed["seconds"])
+	assertions.Equal(expectedMillis, transformed["millis"])
+	assertions.Equal(expectedMillis, transformed["millisString"])
+	assertions.Equal(int64(42), transformed["int"])
+	assertions.Equal("19.99", transformed["decimal"].(primitive.Decimal128).String())
+	assertions.Equal(true, transformed["bool"])
+	assertions.NotContains(transformed, "missing")
+}
+
+func TestCoerce_OnFailure(t *testing.T) {
+	var assertions = assert.New(t)
+	var document = func() map[string]any {
+		return map[string]any{"count": "many", "ratio": 0.5}
+	}
+
+	transformed, err := transforms.Coerce(
+		transforms.Coercion{Path: utils.MustParsePath("count"), Type: transforms.CoerceInt},
+		transforms.Coercion{Path: utils.MustParsePath("ratio"), Type: transforms.CoerceInt, OnFailure: transforms.OnFailureLeave},
+	)(document())
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(document(), transformed, "expected values to be left as they are")
+
+	transformed, err = transforms.Coerce(
+		transforms.Coercion{Path: utils.MustParsePath("count"), Type: transforms.CoerceInt, OnFailure: transforms.OnFailureDrop},
+	)(document())
+	assertions.Nil(err, "expected no error")
+	assertions.NotContains(transformed, "count")
+
+	_, err = transforms.Coerce(
+		transforms.Coercion{Path: utils.MustParsePath("count"), Type: transforms.CoerceInt, OnFailure: transforms.OnFailureError},
+	)(document())
+	assertions.EqualError(err, "could not coerce 'count' to int: 'many' is not an integer")
+}
+
+func TestConfigure_Coercions(t *testing.T) {
+	var assertions = assert.New(t)
+	var registry = transforms.NewRegistry()
+	registry.Register(transforms.Flatten())
+
+	var err = transforms.Configure(registry, &config.Transforms{
+		Coercions: []config.Coercion{
+			{Path: "event.time", Type: transforms.CoerceDate, Format: transforms.FormatRFC3339Nano},
+			{Path: "additionalFields.system-horizon-event-startTime", Type: transforms.CoerceDate, Format: transforms.FormatEpochMillis, Stage: transforms.StageBefore},
+		},
+	})
+	assertions.Nil(err, "expected no error")
+
+	transformed, err := registry.ApplyTransforms(mustReadJson("../../testdata/kafka_msg.json"))
+	assertions.Nil(err, "expected no error")
+
+	var expected = time.Date(2024, 1, 3, 6, 10, 35, 592000000, time.UTC)
+	assertions.Equal(expected, transformed["event.time"])
+	assertions.Equal(expected, transformed["additionalFields.system-horizon-event-startTime"])
+}
+
+func TestConfigure_InvalidCoercions(t *testing.T) {
+	var assertions = assert.New(t)
+	var invalid = []config.Coercion{
+		{Path: "event.time", Type: "timestamp"},
+		{Path: "event.time", Type: transforms.CoerceDate, Format: "iso"},
+		{Path: "event.time", Type: transforms.CoerceDate, OnFailure: "ignore"},
+		{Path: "event.time", Type: transforms.CoerceDate, Stage: "during"},
+		{Path: "", Type: transforms.CoerceDate},
+	}
+
+	for _, coercion := range invalid {
+		var err = transforms.Configure(transforms.NewRegistry(), &config.Transforms{Coercions: []config.Coercion{coercion}})
+		assertions.NotNil(err, "expected %+v to be rejected", coercion)
+	}
+}
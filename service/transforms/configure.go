@@ -0,0 +1,404 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package transforms
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+	"vortex/service/config"
+	"vortex/service/utils"
+)
+
+const (
+	StageBefore = "before"
+	StageAfter  = "after"
+)
+
+const (
+	OperationSet      = "set"
+	OperationCopy     = "copy"
+	OperationMove     = "move"
+	OperationDelete   = "delete"
+	OperationDefault  = "default"
+	OperationCoalesce = "coalesce"
+)
+
+// stages collects configured transformations by the stage they are applied in.
+type stages struct {
+	before []*Transform
+	after  []*Transform
+}
+
+func (s *stages) add(stage string, transform *Transform) error {
+	switch stage {
+
+	case StageBefore:
+		s.before = append(s.before, transform)
+
+	case StageAfter, "":
+		s.after = append(s.after, transform)
+
+	default:
+		return errors.New(fmt.Sprintf("unknown stage '%s'", stage))
+
+	}
+	return nil
+}
+
+// Configure registers the configured transformations in the given registry. Transformations of the stage "before"
+// are applied to the payload as consumed, transformations of the stage "after" to the flattened document.
+// Error policies are applied to all transformations of the registry, including the ones registered beforehand.
+func Configure(registry *Registry, transformsConfig *config.Transforms) error {
+	var configured = new(stages)
+
+	for i, field := range transformsConfig.Fields {
+		var transformFunc, err = newFieldTransform(field)
+		if err != nil {
+			return fmt.Errorf("invalid field transformation #%d: %w", i+1, err)
+		}
+
+		var transform = NewTransform(fmt.Sprintf("%s:%s", field.Operation, field.Path), transformFunc)
+		if len(field.Name) > 0 {
+			transform.Name = field.Name
+		}
+
+		if err := configured.add(field.Stage, transform); err != nil {
+			return fmt.Errorf("invalid field transformation #%d: %w", i+1, err)
+		}
+	}
+
+	for i, scriptConfig := range transformsConfig.Scripts {
+		var transform, err = newScriptTransform(i, scriptConfig)
+		if err != nil {
+			return err
+		}
+
+		if err := configured.add(scriptConfig.Stage, transform); err != nil {
+			return fmt.Errorf("invalid script '%s': %w", transform.Name, err)
+		}
+	}
+
+	if err := configureCoercions(configured, transformsConfig.Coercions); err != nil {
+		return err
+	}
+
+	if err := configurePlugins(configured, &transformsConfig.Plugins); err != nil {
+		return err
+	}
+
+	if err := configureRedaction(configured, &transformsConfig.Redaction); err != nil {
+		return err
+	}
+
+	headers, err := newHeaderTransform(transformsConfig.Headers)
+	if err != nil {
+		return err
+	}
+	if headers != nil {
+		configured.before = append([]*Transform{headers}, configured.before...)
+	}
+
+	registry.Prepend(configured.before...)
+	registry.RegisterTransforms(configured.after...)
+
+	if transformsConfig.Unflatten {
+		var options, err = NewFlattenOptions(&transformsConfig.Flatten)
+		if err != nil {
+			return err
+		}
+		registry.RegisterTransforms(NewTransform("Unflatten", Unflatten(options)))
+	}
+
+	for name, policy := range transformsConfig.ErrorPolicies {
+		if err := registry.SetErrorPolicy(name, policy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsDefault reports whether the configuration keeps the default transformations unchanged.
+func IsDefault(transformsConfig *config.Transforms) bool {
+	var options, err = NewFlattenOptions(&transformsConfig.Flatten)
+	if err != nil {
+		return false
+	}
+
+	return options.Separator == "." && options.MaxDepth == 0 && len(options.Include) == 0 &&
+		len(options.Exclude) == 0 && options.Arrays == utils.ArraysKeep && !transformsConfig.Unflatten &&
+		len(transformsConfig.Fields) == 0 && len(transformsConfig.Scripts) == 0 &&
+		len(transformsConfig.Coercions) == 0 && len(transformsConfig.Headers) == 0 &&
+		len(transformsConfig.Redaction.Fields) == 0 &&
+		len(transformsConfig.Plugins.Directory) == 0 && len(transformsConfig.ErrorPolicies) == 0
+}
+
+// NewFlattenOptions converts the flatten configuration to options, falling back to the defaults for empty values.
+func NewFlattenOptions(flattenConfig *config.Flatten) (utils.FlattenOptions, error) {
+	var options = utils.DefaultFlattenOptions()
+	options.MaxDepth = flattenConfig.MaxDepth
+	options.Include = flattenConfig.Include
+	options.Exclude = flattenConfig.Exclude
+
+	if len(flattenConfig.Separator) > 0 {
+		options.Separator = flattenConfig.Separator
+	}
+	if len(flattenConfig.Arrays) > 0 {
+		options.Arrays = flattenConfig.Arrays
+	}
+	if len(flattenConfig.JoinSeparator) > 0 {
+		options.JoinSeparator = flattenConfig.JoinSeparator
+	}
+
+	if err := options.Validate(); err != nil {
+		return options, fmt.Errorf("invalid flatten configuration: %w", err)
+	}
+	return options, nil
+}
+
+func newFieldTransform(field config.FieldTransform) (TransformFunc, error) {
+	var path, err = utils.ParsePath(field.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch field.Operation {
+
+	case OperationSet:
+		return SetField(path, field.Value), nil
+
+	case OperationDefault:
+		return DefaultField(path, field.Value), nil
+
+	case OperationDelete:
+		return DeleteField(path), nil
+
+	case OperationCopy, OperationMove:
+		from, err := utils.ParsePath(field.From)
+		if err != nil {
+			return nil, err
+		}
+
+		if field.Operation == OperationCopy {
+			return CopyField(from, path), nil
+		}
+		return MoveField(from, path), nil
+
+	case OperationCoalesce:
+		if len(field.Sources) == 0 {
+			return nil, errors.New("coalescing requires at least one source")
+		}
+
+		var sources = make([]*utils.Path, len(field.Sources))
+		for i, source := range field.Sources {
+			if sources[i], err = utils.ParsePath(source); err != nil {
+				return nil, err
+			}
+		}
+		return CoalesceField(path, sources...), nil
+
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown operation '%s'", field.Operation))
+
+	}
+}
+
+// DefaultMaxScriptSteps limits the execution of scripts without a configured step limit.
+const DefaultMaxScriptSteps = 1_000_000
+
+func newScriptTransform(index int, scriptConfig config.Script) (*Transform, error) {
+	var name = scriptConfig.Name
+	if len(name) == 0 {
+		name = fmt.Sprintf("script[%d]", index)
+	}
+
+	var source = scriptConfig.Source
+	if len(scriptConfig.File) > 0 {
+		if len(source) > 0 {
+			return nil, errors.New(fmt.Sprintf("script '%s' must either have a source or a file", name))
+		}
+
+		var content, err = os.ReadFile(scriptConfig.File)
+		if err != nil {
+			return nil, fmt.Errorf("could not read script '%s': %w", name, err)
+		}
+		source = string(content)
+	}
+
+	var maxSteps = scriptConfig.MaxSteps
+	if maxSteps == 0 {
+		maxSteps = DefaultMaxScriptSteps
+	}
+
+	var script, err = NewScript(name, source, maxSteps)
+	if err != nil {
+		return nil, err
+	}
+	return NewMessageTransform(name, script.MessageTransformFunc()), nil
+}
+
+func configureCoercions(configured *stages, coercionConfigs []config.Coercion) error {
+	var before, after = make([]Coercion, 0), make([]Coercion, 0)
+	for _, coercionConfig := range coercionConfigs {
+		var path, err = utils.ParsePath(coercionConfig.Path)
+		if err != nil {
+			return err
+		}
+
+		var coercion = Coercion{
+			Path:      path,
+			Type:      coercionConfig.Type,
+			Format:    coercionConfig.Format,
+			OnFailure: coercionConfig.OnFailure,
+		}
+		if err := coercion.Validate(); err != nil {
+			return err
+		}
+
+		switch coercionConfig.Stage {
+		case StageBefore:
+			before = append(before, coercion)
+		case StageAfter, "":
+			after = append(after, coercion)
+		default:
+			return errors.New(fmt.Sprintf("unknown stage '%s' of field '%s'", coercionConfig.Stage, coercionConfig.Path))
+		}
+	}
+
+	if len(before) > 0 {
+		_ = configured.add(StageBefore, NewTransform("Coerce", Coerce(before...)))
+	}
+	if len(after) > 0 {
+		_ = configured.add(StageAfter, NewTransform("Coerce", Coerce(after...)))
+	}
+	return nil
+}
+
+// newHeaderTransform returns the transformation copying record headers to the payload as consumed, so that they are
+// subject to all other transformations, or nil if no headers are mapped.
+func newHeaderTransform(headerConfigs []config.HeaderMapping) (*Transform, error) {
+	if len(headerConfigs) == 0 {
+		return nil, nil
+	}
+
+	var mappings = make([]HeaderMapping, len(headerConfigs))
+	for i, headerConfig := range headerConfigs {
+		var field, err = utils.ParsePath(headerConfig.Field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid header mapping #%d: %w", i+1, err)
+		}
+
+		mappings[i] = HeaderMapping{
+			Name:      headerConfig.Name,
+			Prefix:    headerConfig.Prefix,
+			Field:     field,
+			Decode:    headerConfig.Decode,
+			OnFailure: headerConfig.OnFailure,
+		}
+		if err := mappings[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return NewMessageTransform("MapHeaders", MapHeaders(mappings...)), nil
+}
+
+// pluginRuntime is kept to release the compiled plugins on shutdown.
+var pluginRuntime *WasmRuntime
+
+func configurePlugins(configured *stages, pluginsConfig *config.Plugins) error {
+	if len(pluginsConfig.Directory) == 0 {
+		return nil
+	}
+
+	var runtime, err = NewWasmRuntime(pluginsConfig.MemoryLimitMb)
+	if err != nil {
+		return fmt.Errorf("could not create plugin runtime: %w", err)
+	}
+
+	plugins, err := runtime.LoadDirectory(pluginsConfig.Directory, time.Duration(pluginsConfig.TimeoutMs)*time.Millisecond)
+	if err != nil {
+		runtime.Close()
+		return err
+	}
+
+	for _, plugin := range plugins {
+		if err := configured.add(pluginsConfig.Stage, NewTransform("plugin:"+plugin.Name, plugin.TransformFunc())); err != nil {
+			runtime.Close()
+			return fmt.Errorf("invalid plugin configuration: %w", err)
+		}
+	}
+
+	ClosePlugins()
+	pluginRuntime = runtime
+	return nil
+}
+
+// ClosePlugins releases all plugins loaded by Configure.
+func ClosePlugins() {
+	if pluginRuntime != nil {
+		pluginRuntime.Close()
+		pluginRuntime = nil
+	}
+}
+
+func configureRedaction(configured *stages, redactionConfig *config.Redaction) error {
+	if len(redactionConfig.Fields) == 0 {
+		return nil
+	}
+
+	var before, after = make([]Redaction, 0), make([]Redaction, 0)
+	var requiresKey = false
+	for _, field := range redactionConfig.Fields {
+		var redaction = Redaction{Path: field.Path, Action: field.Action, Length: field.Length}
+
+		if _, err := utils.ParsePath(field.Path); err != nil {
+			return err
+		}
+
+		switch field.Action {
+		case RedactMask, RedactTruncate, RedactDrop:
+		case RedactHash:
+			requiresKey = true
+		default:
+			return errors.New(fmt.Sprintf("unknown redaction '%s' of field '%s'", field.Action, field.Path))
+		}
+
+		switch field.Stage {
+		case StageBefore:
+			before = append(before, redaction)
+		case StageAfter, "":
+			after = append(after, redaction)
+		default:
+			return errors.New(fmt.Sprintf("unknown stage '%s' of field '%s'", field.Stage, field.Path))
+		}
+	}
+
+	var key []byte
+	if requiresKey {
+		if len(redactionConfig.KeyFile) == 0 {
+			return errors.New("hashing fields requires a key file")
+		}
+
+		var content, err = os.ReadFile(redactionConfig.KeyFile)
+		if err != nil {
+			return fmt.Errorf("could not read redaction key: %w", err)
+		}
+
+		key = bytes.TrimSpace(content)
+		if len(key) == 0 {
+			return errors.New("redaction key must not be empty")
+		}
+	}
+
+	if len(before) > 0 {
+		_ = configured.add(StageBefore, NewTransform("Redact", Redact(key, before...)))
+	}
+	if len(after) > 0 {
+		_ = configured.add(StageAfter, NewTransform("Redact", Redact(key, after...)))
+	}
+	return nil
+}
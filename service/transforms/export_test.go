@@ -0,0 +1,10 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package transforms
+
+// RestoreTypes exposes the restoration of typed values returned by plugins to tests.
+func RestoreTypes(original any, transformed any) any {
+	return restoreTypes(original, transformed)
+}
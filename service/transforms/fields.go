@@ -0,0 +1,90 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package transforms
+
+import (
+	"vortex/service/utils"
+)
+
+// SetField sets the value at the given path, creating missing objects on the way.
+func SetField(path *utils.Path, value any) TransformFunc {
+	return func(data map[string]any) (map[string]any, error) {
+		if err := path.Set(data, value); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+}
+
+// CopyField copies the first value found at from to the given path. Missing sources are ignored.
+func CopyField(from *utils.Path, to *utils.Path) TransformFunc {
+	return func(data map[string]any) (map[string]any, error) {
+		var value, ok = from.Get(data)
+		if !ok {
+			return data, nil
+		}
+
+		if err := to.Set(data, value); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+}
+
+// MoveField moves the first value found at from to the given path. Missing sources are ignored.
+func MoveField(from *utils.Path, to *utils.Path) TransformFunc {
+	return func(data map[string]any) (map[string]any, error) {
+		var matches = from.Find(data)
+		if len(matches) == 0 {
+			return data, nil
+		}
+
+		var value = matches[0].Value()
+		matches[0].Delete()
+
+		if err := to.Set(data, value); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+}
+
+// DeleteField deletes all values found at the given path.
+func DeleteField(path *utils.Path) TransformFunc {
+	return func(data map[string]any) (map[string]any, error) {
+		path.Delete(data)
+		return data, nil
+	}
+}
+
+// DefaultField sets the value at the given path if it is missing or null.
+func DefaultField(path *utils.Path, value any) TransformFunc {
+	return func(data map[string]any) (map[string]any, error) {
+		if current, ok := path.Get(data); ok && current != nil {
+			return data, nil
+		}
+
+		if err := path.Set(data, value); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+}
+
+// CoalesceField sets the value at the given path to the first non-null value found at one of the sources.
+// The target is left untouched if none of the sources holds a value.
+func CoalesceField(path *utils.Path, sources ...*utils.Path) TransformFunc {
+	return func(data map[string]any) (map[string]any, error) {
+		for _, source := range sources {
+			if value, ok := source.Get(data); ok && value != nil {
+				if err := path.Set(data, value); err != nil {
+					return nil, err
+				}
+				return data, nil
+			}
+		}
+		return data, nil
+	}
+}
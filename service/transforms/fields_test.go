@@ -0,0 +1,101 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package transforms_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"vortex/service/config"
+	"vortex/service/transforms"
+	"vortex/service/utils"
+)
+
+func TestFieldTransforms(t *testing.T) {
+	var assertions = assert.New(t)
+	var registry = transforms.NewRegistry()
+	registry.Register(
+		transforms.SetField(utils.MustParsePath("meta.source"), "vortex"),
+		transforms.CopyField(utils.MustParsePath("event.id"), utils.MustParsePath("meta.eventId")),
+		transforms.MoveField(utils.MustParsePath("event.dataref"), utils.MustParsePath("meta.dataref")),
+		transforms.DeleteField(utils.MustParsePath("httpHeaders.*")),
+		transforms.DefaultField(utils.MustParsePath("event.specversion"), "2.0"),
+		transforms.DefaultField(utils.MustParsePath("meta.region"), "eu"),
+		transforms.CoalesceField(utils.MustParsePath("meta.callback"),
+			utils.MustParsePath("additionalFields.missing"),
+			utils.MustParsePath("additionalFields.callback-url"),
+		),
+	)
+
+	transformed, err := registry.ApplyTransforms(mustReadJson("../../testdata/kafka_msg.json"))
+	assertions.Nil(err, "expected no error")
+
+	var meta = transformed["meta"].(map[string]any)
+	assertions.Equal("vortex", meta["source"])
+	assertions.Equal("9906d8c3-b965-4f00-9f98-ae9c96565009", meta["eventId"])
+	assertions.Equal("http://apihost/some/api/v1/resource/1234", meta["dataref"])
+	assertions.Equal("eu", meta["region"])
+	assertions.Equal("https://example.com/callback", meta["callback"])
+
+	var event = transformed["event"].(map[string]any)
+	_, ok := event["dataref"]
+	assertions.False(ok, "expected field 'dataref' to be moved")
+	assertions.Equal("1.0", event["specversion"], "expected existing value not to be replaced by default")
+	assertions.Empty(transformed["httpHeaders"], "expected all headers to be deleted")
+}
+
+func TestSetField_InvalidPath(t *testing.T) {
+	var assertions = assert.New(t)
+	var transformFunc = transforms.SetField(utils.MustParsePath("event.id.value"), 1)
+
+	_, err := transformFunc(map[string]any{"event": map[string]any{"id": "abc"}})
+	assertions.EqualError(err, "could not resolve path 'event.id.value': 'event.id' is a string, not an object or array")
+}
+
+func TestDropEventData_WithoutEvent(t *testing.T) {
+	var assertions = assert.New(t)
+	var transformFunc = transforms.DropEventData()
+
+	transformed, err := transformFunc(map[string]any{"status": "FAILED"})
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(map[string]any{"status": "FAILED"}, transformed)
+}
+
+func TestConfigure_Fields(t *testing.T) {
+	var assertions = assert.New(t)
+	var registry = transforms.NewRegistry()
+	registry.Register(transforms.Flatten())
+
+	var err = transforms.Configure(registry, &config.Transforms{
+		Fields: []config.FieldTransform{
+			{Operation: transforms.OperationMove, From: "event.type", Path: "eventType", Stage: transforms.StageBefore},
+			{Operation: transforms.OperationSet, Path: "source", Value: "vortex"},
+			{Operation: transforms.OperationCoalesce, Path: "callback", Sources: []string{"additionalFields.callback-url"}},
+		},
+	})
+	assertions.Nil(err, "expected no error")
+
+	transformed, err := registry.ApplyTransforms(mustReadJson("../../testdata/kafka_msg.json"))
+	assertions.Nil(err, "expected no error")
+	assertions.Equal("vortex.test.event", transformed["eventType"])
+	assertions.NotContains(transformed, "event.type")
+	assertions.Equal("vortex", transformed["source"])
+	assertions.Equal("https://example.com/callback", transformed["callback"])
+}
+
+func TestConfigure_InvalidFields(t *testing.T) {
+	var assertions = assert.New(t)
+	var invalid = []config.FieldTransform{
+		{Operation: "rename", Path: "event.id"},
+		{Operation: transforms.OperationSet, Path: "event..id"},
+		{Operation: transforms.OperationCopy, Path: "event.id", From: "items[x]"},
+		{Operation: transforms.OperationCoalesce, Path: "event.id"},
+		{Operation: transforms.OperationDelete, Path: "event.id", Stage: "during"},
+	}
+
+	for _, field := range invalid {
+		var err = transforms.Configure(transforms.NewRegistry(), &config.Transforms{Fields: []config.FieldTransform{field}})
+		assertions.NotNil(err, "expected %+v to be rejected", field)
+	}
+}
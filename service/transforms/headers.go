@@ -0,0 +1,184 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package transforms
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"strconv"
+	"strings"
+	"vortex/service/utils"
+)
+
+const (
+	DecodeString    = "string"
+	DecodeInt       = "int"
+	DecodeBinaryInt = "binaryInt"
+	DecodeJson      = "json"
+)
+
+// HeaderMapping describes which record headers are copied to the document. Headers are either matched by their exact
+// Name or by a Prefix, in which case Field is an object holding the matching headers by their name without the prefix.
+// OnFailure decides whether values that cannot be decoded are stored as string (default), dropped or fail the message.
+type HeaderMapping struct {
+	Name      string
+	Prefix    string
+	Field     *utils.Path
+	Decode    string
+	OnFailure string
+}
+
+// Validate returns an error if the mapping matches no or both a name and a prefix or if its decoding is unknown.
+func (m HeaderMapping) Validate() error {
+	if (len(m.Name) == 0) == (len(m.Prefix) == 0) {
+		return errors.New(fmt.Sprintf("header mapping of field '%s' must either have a name or a prefix", m.Field))
+	}
+
+	switch m.Decode {
+	case "", DecodeString, DecodeInt, DecodeBinaryInt, DecodeJson:
+	default:
+		return errors.New(fmt.Sprintf("unknown decoding '%s' of field '%s'", m.Decode, m.Field))
+	}
+
+	switch m.OnFailure {
+	case "", OnFailureLeave, OnFailureDrop, OnFailureError:
+	default:
+		return errors.New(fmt.Sprintf("unknown failure policy '%s' of field '%s'", m.OnFailure, m.Field))
+	}
+	return nil
+}
+
+// MapHeaders copies the values of record headers to the document. If a header occurs multiple times, the last value
+// wins. Headers of prefix mappings are added to the object at the field, keeping its other values.
+func MapHeaders(mappings ...HeaderMapping) MessageTransformFunc {
+	return func(message *sarama.ConsumerMessage, data map[string]any) (map[string]any, error) {
+		if message == nil {
+			return data, nil
+		}
+
+		for _, mapping := range mappings {
+			if len(mapping.Name) > 0 {
+				if err := mapping.mapName(message.Headers, data); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			if err := mapping.mapPrefix(message.Headers, data); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	}
+}
+
+func (m HeaderMapping) mapName(headers []*sarama.RecordHeader, data map[string]any) error {
+	var found *sarama.RecordHeader
+	for _, header := range headers {
+		if string(header.Key) == m.Name {
+			found = header
+		}
+	}
+
+	if found == nil {
+		return nil
+	}
+
+	var value, ok, err = m.decode(found)
+	if err != nil || !ok {
+		return err
+	}
+	return m.Field.Set(data, value)
+}
+
+func (m HeaderMapping) mapPrefix(headers []*sarama.RecordHeader, data map[string]any) error {
+	var fields = make(map[string]any)
+	for _, header := range headers {
+		var name, ok = strings.CutPrefix(string(header.Key), m.Prefix)
+		if !ok || len(name) == 0 {
+			continue
+		}
+
+		value, ok, err := m.decode(header)
+		if err != nil {
+			return err
+		}
+		if ok {
+			fields[name] = value
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	if existing, ok := m.Field.Get(data); ok {
+		if object, ok := existing.(map[string]any); ok {
+			for name, value := range fields {
+				object[name] = value
+			}
+			return nil
+		}
+	}
+	return m.Field.Set(data, fields)
+}
+
+// decode returns the decoded value of the header and whether it should be stored.
+func (m HeaderMapping) decode(header *sarama.RecordHeader) (any, bool, error) {
+	var value, err = decodeHeader(header.Value, m.Decode)
+	if err == nil {
+		return value, true, nil
+	}
+
+	switch m.OnFailure {
+
+	case OnFailureDrop:
+		return nil, false, nil
+
+	case OnFailureError:
+		return nil, false, fmt.Errorf("could not decode header '%s' as %s: %w", header.Key, m.Decode, err)
+
+	default:
+		return string(header.Value), true, nil
+
+	}
+}
+
+func decodeHeader(value []byte, decoding string) (any, error) {
+	switch decoding {
+
+	case DecodeInt:
+		return strconv.ParseInt(strings.TrimSpace(string(value)), 10, 64)
+
+	case DecodeBinaryInt:
+		// big-endian two's complement as written by e.g. Java's ByteBuffer.putInt() or putLong()
+		switch len(value) {
+		case 1:
+			return int64(int8(value[0])), nil
+		case 2:
+			return int64(int16(binary.BigEndian.Uint16(value))), nil
+		case 4:
+			return int64(int32(binary.BigEndian.Uint32(value))), nil
+		case 8:
+			return int64(binary.BigEndian.Uint64(value)), nil
+		default:
+			return nil, errors.New(fmt.Sprintf("expected 1, 2, 4 or 8 bytes but got %d", len(value)))
+		}
+
+	case DecodeJson:
+		var decoded any
+		if err := json.Unmarshal(value, &decoded); err != nil {
+			return nil, err
+		}
+		return decoded, nil
+
+	default:
+		return string(value), nil
+
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package transforms_test
+
+import (
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"vortex/service/config"
+	"vortex/service/transforms"
+	"vortex/service/utils"
+)
+
+var headerMessage = &sarama.ConsumerMessage{
+	Topic: "status",
+	Headers: []*sarama.RecordHeader{
+		{Key: []byte("type"), Value: []byte("MESSAGE")},
+		{Key: []byte("client-id"), Value: []byte("producer-1")},
+		{Key: []byte("schema-version"), Value: []byte("3")},
+		{Key: []byte("sequence"), Value: []byte{0x00, 0x00, 0x01, 0x00}},
+		{Key: []byte("x-meta-region"), Value: []byte("eu")},
+		{Key: []byte("x-meta-tags"), Value: []byte(`["a","b"]`)},
+		{Key: []byte("x-meta-"), Value: []byte("ignored")},
+		{Key: []byte("client-id"), Value: []byte("producer-2")},
+	},
+}
+
+func TestMapHeaders(t *testing.T) {
+	var assertions = assert.New(t)
+	var transformFunc = transforms.MapHeaders(
+		transforms.HeaderMapping{Name: "client-id", Field: utils.MustParsePath("producer.clientId")},
+		transforms.HeaderMapping{Name: "schema-version", Field: utils.MustParsePath("producer.schemaVersion"), Decode: transforms.DecodeInt},
+		transforms.HeaderMapping{Name: "sequence", Field: utils.MustParsePath("sequence"), Decode: transforms.DecodeBinaryInt},
+		transforms.HeaderMapping{Prefix: "x-meta-", Field: utils.MustParsePath("meta"), Decode: transforms.DecodeJson},
+		transforms.HeaderMapping{Name: "missing", Field: utils.MustParsePath("missing")},
+	)
+
+	transformed, err := transformFunc(headerMessage, map[string]any{"meta": map[string]any{"existing": true}})
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(map[string]any{
+		"producer": map[string]any{"clientId": "producer-2", "schemaVersion": int64(3)},
+		"sequence": int64(256),
+		"meta":     map[string]any{"existing": true, "region": "eu", "tags": []any{"a", "b"}},
+	}, transformed)
+
+	transformed, err = transformFunc(nil, map[string]any{})
+	assertions.Nil(err, "expected no error")
+	assertions.Empty(transformed, "expected no headers to be mapped without a message")
+}
+
+func TestMapHeaders_OnFailure(t *testing.T) {
+	var assertions = assert.New(t)
+	var mapping = transforms.HeaderMapping{Name: "client-id", Field: utils.MustParsePath("clientId"), Decode: transforms.DecodeInt}
+
+	transformed, err := transforms.MapHeaders(mapping)(headerMessage, map[string]any{})
+	assertions.Nil(err, "expected no error")
+	assertions.Equal("producer-2", transformed["clientId"], "expected undecodable values to be stored as string")
+
+	mapping.OnFailure = transforms.OnFailureDrop
+	transformed, err = transforms.MapHeaders(mapping)(headerMessage, map[string]any{})
+	assertions.Nil(err, "expected no error")
+	assertions.NotContains(transformed, "clientId")
+
+	mapping.OnFailure = transforms.OnFailureError
+	_, err = transforms.MapHeaders(mapping)(headerMessage, map[string]any{})
+	assertions.NotNil(err, "expected undecodable values to fail the message")
+
+	mapping = transforms.HeaderMapping{Name: "client-id", Field: utils.MustParsePath("clientId"), Decode: transforms.DecodeBinaryInt, OnFailure: transforms.OnFailureError}
+	_, err = transforms.MapHeaders(mapping)(headerMessage, map[string]any{})
+	assertions.NotNil(err, "expected binary integers of unexpected length to fail the message")
+}
+
+func TestConfigure_Headers(t *testing.T) {
+	var assertions = assert.New(t)
+	var registry = transforms.NewDefaultRegistry(utils.DefaultFlattenOptions())
+
+	var err = transforms.Configure(registry, &config.Transforms{
+		Headers: []config.HeaderMapping{
+			{Name: "client-id", Field: "producer.clientId"},
+			{Prefix: "x-meta-", Field: "meta"},
+		},
+		Fields: []config.FieldTransform{
+			{Operation: transforms.OperationCopy, From: "producer.clientId", Path: "clientId", Stage: transforms.StageBefore},
+		},
+	})
+	assertions.Nil(err, "expected no error")
+
+	transformed, err := registry.ApplyMessageTransforms(headerMessage, mustReadJson("../../testdata/kafka_msg.json"))
+	assertions.Nil(err, "expected no error")
+	assertions.Equal("producer-2", transformed["producer.clientId"], "expected mapped headers to be flattened")
+	assertions.Equal("producer-2", transformed["clientId"], "expected mapped headers to be available to other transformations")
+	assertions.Equal("eu", transformed["meta.region"])
+	assertions.False(transforms.IsDefault(&config.Transforms{Headers: []config.HeaderMapping{{Name: "client-id", Field: "clientId"}}}))
+}
+
+func TestConfigure_InvalidHeaders(t *testing.T) {
+	var cases = map[string]config.HeaderMapping{
+		"missing field":      {Name: "client-id"},
+		"name and prefix":    {Name: "client-id", Prefix: "x-", Field: "clientId"},
+		"no name nor prefix": {Field: "clientId"},
+		"unknown decoding":   {Name: "client-id", Field: "clientId", Decode: "avro"},
+		"unknown policy":     {Name: "client-id", Field: "clientId", OnFailure: "retry"},
+	}
+
+	for name, mapping := range cases {
+		t.Run(name, func(t *testing.T) {
+			var err = transforms.Configure(transforms.NewRegistry(), &config.Transforms{Headers: []config.HeaderMapping{mapping}})
+			assert.NotNil(t, err, "expected an error")
+		})
+	}
+}
@@ -14,28 +14,12 @@ import (
 )
 
 func RenameAdditionalFields() TransformFunc {
-	return func(data map[string]any) (map[string]any, error) {
-		if _, ok := data["additionalFields"]; !ok {
-			return data, nil
-		}
-
-		data["properties"] = data["additionalFields"]
-		delete(data, "additionalFields")
-		return data, nil
-	}
+	return MoveField(utils.MustParsePath("additionalFields"), utils.MustParsePath("properties"))
 }
 
 // AddEventUnderscoreIdField add _id to event, because the spring projects read id from _id
 func AddEventUnderscoreIdField() TransformFunc {
-	return func(data map[string]any) (map[string]any, error) {
-		var event, ok = data["event"].(map[string]any)
-		if ok {
-			event["_id"] = event["id"]
-			data["event"] = event
-		}
-
-		return data, nil
-	}
+	return CopyField(utils.MustParsePath("event.id"), utils.MustParsePath("event._id"))
 }
 
 // MoveTimestamp is currently not used (on purpose)
@@ -108,7 +92,10 @@ func EnrichPropertiesFromHttpHeaders() TransformFunc {
 			}
 
 			// Normally length is always = 1, but to ensure possible added fields joining all values
-			headerArrayStrings := stringifySlice(headerArray)
+			headerArrayStrings, err := stringifySlice(headerArray)
+			if err != nil {
+				return nil, fmt.Errorf("could not read header '%s': %w", headerToInclude, err)
+			}
 			properties[headerToInclude] = strings.Join(headerArrayStrings, ",")
 		}
 
@@ -126,12 +113,7 @@ func DropHttpHeaders() TransformFunc {
 }
 
 func DropEventData() TransformFunc {
-	return func(data map[string]any) (map[string]any, error) {
-		var event = data["event"].(map[string]any)
-		delete(event, "data")
-		data["event"] = event
-		return data, nil
-	}
+	return DeleteField(utils.MustParsePath("event.data"))
 }
 
 func Flatten() TransformFunc {
@@ -140,6 +122,19 @@ func Flatten() TransformFunc {
 	}
 }
 
+func FlattenWithOptions(options utils.FlattenOptions) TransformFunc {
+	return func(data map[string]any) (map[string]any, error) {
+		return utils.FlattenWithOptions(data, "", options), nil
+	}
+}
+
+// Unflatten restores nested documents from documents flattened with the given options.
+func Unflatten(options utils.FlattenOptions) TransformFunc {
+	return func(data map[string]any) (map[string]any, error) {
+		return utils.Unflatten(data, options)
+	}
+}
+
 func DeleteFlatKeys(keys ...string) TransformFunc {
 	return func(data map[string]any) (map[string]any, error) {
 		for _, key := range keys {
@@ -149,10 +144,14 @@ func DeleteFlatKeys(keys ...string) TransformFunc {
 	}
 }
 
-func stringifySlice(slice []any) []string {
+func stringifySlice(slice []any) ([]string, error) {
 	stringSlice := make([]string, len(slice))
 	for i, v := range slice {
-		stringSlice[i] = v.(string)
+		value, ok := v.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("value #%d is of type %T instead of string", i+1, v))
+		}
+		stringSlice[i] = value
 	}
-	return stringSlice
+	return stringSlice, nil
 }
@@ -5,11 +5,14 @@
 package transforms_test
 
 import (
+	"fmt"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"log"
 	"testing"
 	"time"
 	"vortex/service/transforms"
+	"vortex/service/utils"
 )
 
 var (
@@ -137,6 +140,26 @@ func TestEnrichPropertiesFromHttpHeaders(t *testing.T) {
 	assertions.Equal("somecorrelation", correlationId, "expected field 'x-correlation-id' to be 'somecorrelation'")
 }
 
+func TestEnrichPropertiesFromHttpHeaders_NonString(t *testing.T) {
+	var assertions = assert.New(t)
+	var document = map[string]any{
+		"properties":  map[string]any{},
+		"httpHeaders": map[string]any{"x-correlation-id": []any{float64(123)}},
+	}
+
+	assertions.NotPanics(func() {
+		var _, err = transforms.EnrichPropertiesFromHttpHeaders()(document)
+		assertions.NotNil(err, "expected an error for non-string header values")
+	})
+
+	var registry = transforms.NewRegistry()
+	registry.Register(transforms.EnrichPropertiesFromHttpHeaders())
+	assertions.Nil(registry.SetErrorPolicy("EnrichPropertiesFromHttpHeaders", transforms.OnErrorSkip))
+	transformed, err := registry.ApplyTransforms(document)
+	assertions.Nil(err, "expected the error policy to apply")
+	assertions.Equal(map[string]any{}, transformed["properties"])
+}
+
 func TestDropHttpHeaders(t *testing.T) {
 	var assertions = assert.New(t)
 	var transformFunc = transforms.DropHttpHeaders()
@@ -182,6 +205,29 @@ func TestFlatten(t *testing.T) {
 		_, ok := value.(map[string]any)
 		assertions.False(ok, "expected value of field '%s' to not be a map", key)
 	}
+
+	transformed, err = transformFunc(createWorkingCopy(KafkaMessage))
+	assertions.Nil(err, "expected no error")
+	assertions.Equal("0df6658da8ecfa2da46ab6cbf9010db601454b2f", transformed["subscriptionId"])
+	assertions.Equal("9906d8c3-b965-4f00-9f98-ae9c96565009", transformed["event.id"])
+	assertions.Equal([]any{"0.0.0.0"}, transformed["httpHeaders.x-real-ip"], "expected arrays to be kept")
+}
+
+func TestUnflatten(t *testing.T) {
+	var assertions = assert.New(t)
+	var options = utils.DefaultFlattenOptions()
+	options.Separator = "_"
+	options.Arrays = utils.ArraysIndex
+
+	flattened, err := transforms.FlattenWithOptions(options)(map[string]any{
+		"event": map[string]any{"id": "1", "types": []any{"a", "b"}},
+	})
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(map[string]any{"event_id": "1", "event_types_0": "a", "event_types_1": "b"}, flattened)
+
+	unflattened, err := transforms.Unflatten(options)(flattened)
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(map[string]any{"event": map[string]any{"id": "1", "types": []any{"a", "b"}}}, unflattened)
 }
 
 func TestDeleteFlatKeys(t *testing.T) {
@@ -203,3 +249,24 @@ func TestDeleteFlatKeys(t *testing.T) {
 	_, ok = transformed["event.id"]
 	assertions.False(ok, "expected field 'event.id' to not exist")
 }
+
+func BenchmarkEnrichPropertiesFromHttpHeaders(b *testing.B) {
+	var httpHeaders = make(map[string]any, 500)
+	for i := 0; i < 500; i++ {
+		httpHeaders[fmt.Sprintf("x-custom-header-%d", i)] = []any{fmt.Sprintf("value-%d", i)}
+	}
+	httpHeaders["x-business-context"] = []any{"somecontext"}
+	httpHeaders["x-correlation-id"] = []any{"somecorrelation", "othercorrelation"}
+
+	var transformFunc = transforms.EnrichPropertiesFromHttpHeaders()
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var data = map[string]any{"properties": map[string]any{}, "httpHeaders": httpHeaders}
+		if _, err := transformFunc(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package transforms
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"vortex/service/utils"
+)
+
+const (
+	RedactMask     = "mask"
+	RedactTruncate = "truncate"
+	RedactDrop     = "drop"
+	RedactHash     = "hash"
+)
+
+// Redaction describes how the value at a dotted path is redacted.
+// Length is the amount of leading characters kept by mask and truncate.
+type Redaction struct {
+	Path   string
+	Action string
+	Length int
+}
+
+// Redact masks, truncates, drops or HMAC-hashes the values at the given paths. Paths are resolved in nested as well as
+// in flattened documents, so the transformation can be applied before and after Flatten().
+// Lists of values (e.g. httpHeaders) are redacted element-wise.
+func Redact(key []byte, redactions ...Redaction) TransformFunc {
+	var paths = make([]*utils.Path, len(redactions))
+	var redactFuncs = make([]func(string) string, len(redactions))
+	for i, redaction := range redactions {
+		paths[i] = utils.MustParsePath(redaction.Path)
+		redactFuncs[i] = redaction.apply(key)
+	}
+
+	return func(data map[string]any) (map[string]any, error) {
+		for i, redaction := range redactions {
+			for _, match := range paths[i].Find(data) {
+				if redaction.Action == RedactDrop {
+					match.Delete()
+				} else {
+					match.Set(redactValue(match.Value(), redactFuncs[i]))
+				}
+			}
+		}
+		return data, nil
+	}
+}
+
+func (r Redaction) apply(key []byte) func(string) string {
+	switch r.Action {
+
+	case RedactMask:
+		return func(value string) string {
+			var runes = []rune(value)
+			if len(runes) <= r.Length {
+				return value
+			}
+			return string(runes[:r.Length]) + strings.Repeat("*", len(runes)-r.Length)
+		}
+
+	case RedactTruncate:
+		return func(value string) string {
+			var runes = []rune(value)
+			if len(runes) <= r.Length {
+				return value
+			}
+			return string(runes[:r.Length])
+		}
+
+	case RedactHash:
+		return func(value string) string {
+			var mac = hmac.New(sha256.New, key)
+			mac.Write([]byte(value))
+			return hex.EncodeToString(mac.Sum(nil))
+		}
+
+	default:
+		return func(value string) string {
+			return value
+		}
+
+	}
+}
+
+func redactValue(value any, redactFunc func(string) string) any {
+	switch casted := value.(type) {
+
+	case nil:
+		return nil
+
+	case string:
+		return redactFunc(casted)
+
+	case []any:
+		var redacted = make([]any, len(casted))
+		for i, element := range casted {
+			redacted[i] = redactValue(element, redactFunc)
+		}
+		return redacted
+
+	default:
+		return redactFunc(fmt.Sprint(casted))
+
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package transforms_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"vortex/service/config"
+	"vortex/service/transforms"
+)
+
+func TestRedact_Nested(t *testing.T) {
+	var assertions = assert.New(t)
+	var key = []byte("secret")
+	var transformFunc = transforms.Redact(key,
+		transforms.Redaction{Path: "additionalFields.callback-url", Action: transforms.RedactHash},
+		transforms.Redaction{Path: "httpHeaders.x-real-ip", Action: transforms.RedactMask, Length: 2},
+		transforms.Redaction{Path: "httpHeaders.user-agent", Action: transforms.RedactDrop},
+		transforms.Redaction{Path: "event.dataref", Action: transforms.RedactTruncate, Length: 14},
+		transforms.Redaction{Path: "does.not.exist", Action: transforms.RedactDrop},
+	)
+
+	transformed, err := transformFunc(mustReadJson("../../testdata/kafka_msg.json"))
+	assertions.Nil(err, "expected no error")
+
+	var additionalFields = transformed["additionalFields"].(map[string]any)
+	assertions.Equal(hmacHex(key, "https://example.com/callback"), additionalFields["callback-url"])
+
+	var httpHeaders = transformed["httpHeaders"].(map[string]any)
+	assertions.Equal([]any{"0.*****"}, httpHeaders["x-real-ip"], "expected list values to be masked element-wise")
+
+	_, ok := httpHeaders["user-agent"]
+	assertions.False(ok, "expected field 'user-agent' to be dropped")
+
+	var event = transformed["event"].(map[string]any)
+	assertions.Equal("http://apihost", event["dataref"])
+}
+
+func TestRedact_Flat(t *testing.T) {
+	var assertions = assert.New(t)
+	var key = []byte("secret")
+	var transformFunc = transforms.Redact(key,
+		transforms.Redaction{Path: "properties.callback-url", Action: transforms.RedactHash},
+	)
+
+	transformed, err := transformFunc(map[string]any{"properties.callback-url": "https://example.com/callback"})
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(hmacHex(key, "https://example.com/callback"), transformed["properties.callback-url"])
+}
+
+func TestConfigure_Redaction(t *testing.T) {
+	var assertions = assert.New(t)
+	var keyFile = filepath.Join(t.TempDir(), "key")
+	assertions.Nil(os.WriteFile(keyFile, []byte("secret\n"), 0600))
+
+	var registry = transforms.NewRegistry()
+	registry.Register(transforms.Flatten())
+
+	var err = transforms.Configure(registry, &config.Transforms{
+		Redaction: config.Redaction{
+			KeyFile: keyFile,
+			Fields: []config.RedactedField{
+				{Path: "additionalFields.callback-url", Action: transforms.RedactHash, Stage: transforms.StageBefore},
+				{Path: "event.id", Action: transforms.RedactMask, Length: 4},
+			},
+		},
+	})
+	assertions.Nil(err, "expected no error")
+
+	transformed, err := registry.ApplyTransforms(mustReadJson("../../testdata/kafka_msg.json"))
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(hmacHex([]byte("secret"), "https://example.com/callback"), transformed["additionalFields.callback-url"])
+	assertions.Equal("9906********************************", transformed["event.id"])
+}
+
+func TestConfigure_RedactionWithoutKey(t *testing.T) {
+	var assertions = assert.New(t)
+	var err = transforms.Configure(transforms.NewRegistry(), &config.Transforms{
+		Redaction: config.Redaction{
+			Fields: []config.RedactedField{{Path: "event.id", Action: transforms.RedactHash}},
+		},
+	})
+	assertions.NotNil(err, "expected hashing without key to be rejected")
+}
+
+func hmacHex(key []byte, value string) string {
+	var mac = hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
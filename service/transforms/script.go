@@ -0,0 +1,245 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package transforms
+
+import (
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	starlarkjson "go.starlark.net/lib/json"
+	starlarktime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"math"
+	"time"
+)
+
+// ScriptFunction is the function a script has to define. It receives the document and the metadata of the message
+// and returns the modified document or None to drop the message.
+const ScriptFunction = "transform"
+
+// Script is a Starlark transformation, which is compiled once and executed with a fresh thread per message.
+type Script struct {
+	Name     string
+	MaxSteps uint64
+
+	function starlark.Callable
+}
+
+func NewScript(name string, source string, maxSteps uint64) (*Script, error) {
+	var thread = &starlark.Thread{Name: name}
+	thread.SetMaxExecutionSteps(maxSteps)
+
+	var predeclared = starlark.StringDict{
+		"json": starlarkjson.Module,
+		"time": starlarktime.Module,
+	}
+
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, name, source, predeclared)
+	if err != nil {
+		return nil, fmt.Errorf("could not compile script '%s': %w", name, err)
+	}
+
+	var function, ok = globals[ScriptFunction].(starlark.Callable)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("script '%s' does not define a function '%s'", name, ScriptFunction))
+	}
+
+	globals.Freeze()
+	return &Script{Name: name, MaxSteps: maxSteps, function: function}, nil
+}
+
+// MessageTransformFunc returns the script as transformation. Messages are dropped if the script returns None.
+func (s *Script) MessageTransformFunc() MessageTransformFunc {
+	return func(message *sarama.ConsumerMessage, data map[string]any) (map[string]any, error) {
+		var document, err = toStarlark(data)
+		if err != nil {
+			return nil, err
+		}
+
+		var thread = &starlark.Thread{Name: s.Name}
+		thread.SetMaxExecutionSteps(s.MaxSteps)
+
+		result, err := starlark.Call(thread, s.function, starlark.Tuple{document, scriptMetadata(message)}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("script '%s' failed: %w", s.Name, err)
+		}
+
+		if result == starlark.None {
+			return nil, fmt.Errorf("%w by script '%s'", ErrMessageDropped, s.Name)
+		}
+
+		transformed, err := fromStarlark(result)
+		if err != nil {
+			return nil, fmt.Errorf("script '%s' returned an invalid document: %w", s.Name, err)
+		}
+
+		var transformedMap, ok = transformed.(map[string]any)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("script '%s' returned %s instead of a dict", s.Name, result.Type()))
+		}
+		return transformedMap, nil
+	}
+}
+
+func scriptMetadata(message *sarama.ConsumerMessage) *starlark.Dict {
+	var metadata = starlark.NewDict(5)
+	if message == nil {
+		return metadata
+	}
+
+	var headers = starlark.NewDict(len(message.Headers))
+	for _, header := range message.Headers {
+		_ = headers.SetKey(starlark.String(header.Key), starlark.String(header.Value))
+	}
+
+	_ = metadata.SetKey(starlark.String("topic"), starlark.String(message.Topic))
+	_ = metadata.SetKey(starlark.String("key"), starlark.String(message.Key))
+	_ = metadata.SetKey(starlark.String("headers"), headers)
+	_ = metadata.SetKey(starlark.String("partition"), starlark.MakeInt(int(message.Partition)))
+	_ = metadata.SetKey(starlark.String("offset"), starlark.MakeInt64(message.Offset))
+	return metadata
+}
+
+// opaqueValue passes values without a Starlark equivalent (e.g. BSON decimals) through scripts unchanged.
+type opaqueValue struct {
+	value any
+}
+
+func (v opaqueValue) String() string        { return fmt.Sprint(v.value) }
+func (v opaqueValue) Type() string          { return fmt.Sprintf("%T", v.value) }
+func (v opaqueValue) Freeze()               {}
+func (v opaqueValue) Truth() starlark.Bool  { return starlark.True }
+func (v opaqueValue) Hash() (uint32, error) { return 0, errors.New(fmt.Sprintf("unhashable: %T", v.value)) }
+
+func toStarlark(value any) (starlark.Value, error) {
+	switch casted := value.(type) {
+
+	case nil:
+		return starlark.None, nil
+
+	case bool:
+		return starlark.Bool(casted), nil
+
+	case string:
+		return starlark.String(casted), nil
+
+	case int:
+		return starlark.MakeInt(casted), nil
+
+	case int32:
+		return starlark.MakeInt(int(casted)), nil
+
+	case int64:
+		return starlark.MakeInt64(casted), nil
+
+	case float64:
+		return starlark.Float(casted), nil
+
+	case time.Time:
+		return starlarktime.Time(casted), nil
+
+	case map[string]any:
+		var dict = starlark.NewDict(len(casted))
+		for key, element := range casted {
+			var converted, err = toStarlark(element)
+			if err != nil {
+				return nil, err
+			}
+			_ = dict.SetKey(starlark.String(key), converted)
+		}
+		return dict, nil
+
+	case []any:
+		var elements = make([]starlark.Value, len(casted))
+		for i, element := range casted {
+			var converted, err = toStarlark(element)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = converted
+		}
+		return starlark.NewList(elements), nil
+
+	default:
+		return opaqueValue{value}, nil
+
+	}
+}
+
+func fromStarlark(value starlark.Value) (any, error) {
+	switch casted := value.(type) {
+
+	case starlark.NoneType:
+		return nil, nil
+
+	case starlark.Bool:
+		return bool(casted), nil
+
+	case starlark.String:
+		return string(casted), nil
+
+	case starlark.Int:
+		var converted, ok = casted.Int64()
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("integer %s is out of range", casted))
+		}
+		return converted, nil
+
+	case starlark.Float:
+		if math.IsNaN(float64(casted)) || math.IsInf(float64(casted), 0) {
+			return nil, errors.New(fmt.Sprintf("float %s cannot be stored", casted))
+		}
+		return float64(casted), nil
+
+	case starlarktime.Time:
+		return time.Time(casted), nil
+
+	case opaqueValue:
+		return casted.value, nil
+
+	case *starlark.Dict:
+		var converted = make(map[string]any, casted.Len())
+		for _, item := range casted.Items() {
+			var key, ok = item[0].(starlark.String)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("key %s is not a string", item[0]))
+			}
+
+			element, err := fromStarlark(item[1])
+			if err != nil {
+				return nil, err
+			}
+			converted[string(key)] = element
+		}
+		return converted, nil
+
+	case *starlark.List:
+		return fromIterable(casted, casted.Len())
+
+	case starlark.Tuple:
+		return fromIterable(casted, casted.Len())
+
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported type %s", value.Type()))
+
+	}
+}
+
+func fromIterable(iterable starlark.Iterable, length int) ([]any, error) {
+	var converted = make([]any, 0, length)
+	var iterator = iterable.Iterate()
+	defer iterator.Done()
+
+	var element starlark.Value
+	for iterator.Next(&element) {
+		var convertedElement, err = fromStarlark(element)
+		if err != nil {
+			return nil, err
+		}
+		converted = append(converted, convertedElement)
+	}
+	return converted, nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package transforms_test
+
+import (
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+	"time"
+	"vortex/service/config"
+	"vortex/service/transforms"
+)
+
+var scriptMessage = &sarama.ConsumerMessage{
+	Topic:     "status",
+	Key:       []byte("9475695c"),
+	Partition: 3,
+	Offset:    42,
+	Headers:   []*sarama.RecordHeader{{Key: []byte("type"), Value: []byte("MESSAGE")}},
+}
+
+func TestScript(t *testing.T) {
+	var assertions = assert.New(t)
+	var script, err = transforms.NewScript("enrich", `
+def transform(document, metadata):
+    document["source"] = "%s/%d/%d" % (metadata["topic"], metadata["partition"], metadata["offset"])
+    document["type"] = metadata["headers"]["type"]
+    document["key"] = metadata["key"]
+    document["retries"] = document.get("retries", 0) + 1
+    document["tags"] = [tag.upper() for tag in document["tags"]]
+    document["year"] = document["modified"].year
+    document.pop("secret")
+    return document
+`, 10000)
+	assertions.Nil(err, "expected no error")
+
+	var modified = time.Date(2024, 1, 3, 6, 10, 35, 0, time.UTC)
+	var price, _ = primitive.ParseDecimal128("19.99")
+	transformed, err := script.MessageTransformFunc()(scriptMessage, map[string]any{
+		"retries":  1.0,
+		"tags":     []any{"a", "b"},
+		"modified": modified,
+		"price":    price,
+		"secret":   "value",
+	})
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(map[string]any{
+		"source":   "status/3/42",
+		"type":     "MESSAGE",
+		"key":      "9475695c",
+		"retries":  2.0,
+		"tags":     []any{"A", "B"},
+		"year":     int64(2024),
+		"modified": modified,
+		"price":    price,
+	}, transformed)
+}
+
+func TestScript_Drop(t *testing.T) {
+	var assertions = assert.New(t)
+	var script, err = transforms.NewScript("drop", `
+def transform(document, metadata):
+    if document.get("environment") == "playground":
+        return None
+    return document
+`, 10000)
+	assertions.Nil(err, "expected no error")
+
+	var registry = transforms.NewRegistry()
+	registry.RegisterTransforms(transforms.NewMessageTransform(script.Name, script.MessageTransformFunc()))
+
+	_, err = registry.ApplyMessageTransforms(scriptMessage, map[string]any{"environment": "playground"})
+	assertions.True(errors.Is(err, transforms.ErrMessageDropped), "expected message to be dropped")
+
+	transformed, err := registry.ApplyMessageTransforms(scriptMessage, map[string]any{"environment": "integration"})
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(map[string]any{"environment": "integration"}, transformed)
+}
+
+func TestScript_MaxSteps(t *testing.T) {
+	var assertions = assert.New(t)
+	var script, err = transforms.NewScript("loop", `
+def transform(document, metadata):
+    for i in range(1000000000):
+        document["i"] = i
+    return document
+`, 1000)
+	assertions.Nil(err, "expected no error")
+
+	_, err = script.MessageTransformFunc()(nil, map[string]any{})
+	assertions.ErrorContains(err, "too many steps")
+}
+
+func TestScript_Invalid(t *testing.T) {
+	var assertions = assert.New(t)
+
+	_, err := transforms.NewScript("syntax", "def transform(document, metadata)\n", 1000)
+	assertions.NotNil(err, "expected syntax error")
+
+	_, err = transforms.NewScript("missing", "def other(document, metadata):\n    return document\n", 1000)
+	assertions.EqualError(err, "script 'missing' does not define a function 'transform'")
+
+	script, err := transforms.NewScript("result", "def transform(document, metadata):\n    return [1]\n", 1000)
+	assertions.Nil(err, "expected no error")
+	_, err = script.MessageTransformFunc()(nil, map[string]any{})
+	assertions.EqualError(err, "script 'result' returned list instead of a dict")
+}
+
+func TestConfigure_Scripts(t *testing.T) {
+	var assertions = assert.New(t)
+	var registry = transforms.NewRegistry()
+	registry.Register(transforms.Flatten())
+
+	var err = transforms.Configure(registry, &config.Transforms{
+		Scripts: []config.Script{
+			{Source: "def transform(document, metadata):\n    document['event']['topic'] = metadata['topic']\n    return document\n", Stage: transforms.StageBefore},
+			{Name: "late", Source: "def transform(document, metadata):\n    document['late'] = 'event.topic' in document\n    return document\n"},
+		},
+	})
+	assertions.Nil(err, "expected no error")
+
+	transformed, err := registry.ApplyMessageTransforms(scriptMessage, map[string]any{"event": map[string]any{}})
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(map[string]any{"event.topic": "status", "late": true}, transformed)
+	assertions.Nil(registry.SetErrorPolicy("script[0]", transforms.OnErrorSkip), "expected unnamed scripts to be named by index")
+
+	err = transforms.Configure(transforms.NewRegistry(), &config.Transforms{
+		Scripts: []config.Script{{Source: "x = 1", File: "script.star"}},
+	})
+	assertions.NotNil(err, "expected script with source and file to be rejected")
+}
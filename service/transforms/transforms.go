@@ -4,55 +4,188 @@
 
 package transforms
 
+import (
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/rs/zerolog/log"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+	"vortex/service/metrics"
+	"vortex/service/utils"
+)
+
+const (
+	OnErrorFail = "fail"
+	OnErrorSkip = "skip"
+	OnErrorDrop = "drop"
+)
+
+// ErrMessageDropped is returned by ApplyTransforms if a transformation drops the message, either on purpose or
+// because of its error policy.
+var ErrMessageDropped = errors.New("message dropped")
+
 var GlobalRegistry *Registry
 
 type Registry struct {
-	transforms []TransformFunc
+	transforms []*Transform
 }
 
 type TransformFunc func(data map[string]any) (map[string]any, error)
 
+// MessageTransformFunc is a transformation that additionally depends on the metadata of the consumed message.
+// The message is nil if the registry is applied without one.
+type MessageTransformFunc func(message *sarama.ConsumerMessage, data map[string]any) (map[string]any, error)
+
+// Transform is a named transformation and the policy applied if it fails: the message either fails (default),
+// the transformation is skipped or the message is dropped. Skipped transformations may have modified the document
+// before failing.
+type Transform struct {
+	Name        string
+	OnError     string
+	Func        TransformFunc
+	MessageFunc MessageTransformFunc
+}
+
+func NewTransform(name string, transformFunc TransformFunc) *Transform {
+	return &Transform{Name: name, OnError: OnErrorFail, Func: transformFunc}
+}
+
+func NewMessageTransform(name string, messageTransformFunc MessageTransformFunc) *Transform {
+	return &Transform{Name: name, OnError: OnErrorFail, MessageFunc: messageTransformFunc}
+}
+
+func (t *Transform) apply(message *sarama.ConsumerMessage, data map[string]any) (map[string]any, error) {
+	if t.MessageFunc != nil {
+		return t.MessageFunc(message, data)
+	}
+	return t.Func(data)
+}
+
 func NewRegistry() *Registry {
 	return &Registry{
-		make([]TransformFunc, 0),
+		make([]*Transform, 0),
 	}
 }
 
 func init() {
-	GlobalRegistry = NewRegistry()
-	GlobalRegistry.Register(
-		RenameAdditionalFields(),
-		EnrichPropertiesFromHttpHeaders(),
-		DropHttpHeaders(),
-		DropEventData(),
-		AddTimestampIfDropped(),
-		UpdateModifiedTime(),
-		AddEventUnderscoreIdField(),
-		Flatten(),
-		DeleteFlatKeys(
-			"event.source",
-			"event.specversion",
-			"event.datacontenttype",
-			"event.dataref",
+	GlobalRegistry = NewDefaultRegistry(utils.DefaultFlattenOptions())
+}
+
+// NewDefaultRegistry creates a registry with the transformations applied to every Horizon status message.
+func NewDefaultRegistry(flattenOptions utils.FlattenOptions) *Registry {
+	var flatKey = func(keys ...string) string {
+		return strings.Join(keys, flattenOptions.Separator)
+	}
+
+	var registry = NewRegistry()
+	registry.RegisterTransforms(
+		NewTransform("RenameAdditionalFields", RenameAdditionalFields()),
+		NewTransform("EnrichPropertiesFromHttpHeaders", EnrichPropertiesFromHttpHeaders()),
+		NewTransform("DropHttpHeaders", DropHttpHeaders()),
+		NewTransform("DropEventData", DropEventData()),
+		NewTransform("AddTimestampIfDropped", AddTimestampIfDropped()),
+		NewTransform("UpdateModifiedTime", UpdateModifiedTime()),
+		NewTransform("AddEventUnderscoreIdField", AddEventUnderscoreIdField()),
+		NewTransform("Flatten", FlattenWithOptions(flattenOptions)),
+		NewTransform("DeleteFlatKeys", DeleteFlatKeys(
+			flatKey("event", "source"),
+			flatKey("event", "specversion"),
+			flatKey("event", "datacontenttype"),
+			flatKey("event", "dataref"),
 			"uuid",
-		),
+		)),
 	)
+	return registry
 }
 
+// Register registers transformations named after the function that created them.
 func (r *Registry) Register(transformFuncs ...TransformFunc) {
 	for _, transformFunc := range transformFuncs {
-		r.transforms = append(r.transforms, transformFunc)
+		r.transforms = append(r.transforms, NewTransform(funcName(transformFunc), transformFunc))
 	}
 }
 
+func (r *Registry) RegisterTransforms(transforms ...*Transform) {
+	r.transforms = append(r.transforms, transforms...)
+}
+
+// Prepend registers transformations that are applied before all previously registered ones.
+func (r *Registry) Prepend(transforms ...*Transform) {
+	r.transforms = append(append(make([]*Transform, 0, len(transforms)+len(r.transforms)), transforms...), r.transforms...)
+}
+
+// SetErrorPolicy sets the error policy of all transformations with the given name (case-insensitive).
+func (r *Registry) SetErrorPolicy(name string, policy string) error {
+	switch policy {
+	case OnErrorFail, OnErrorSkip, OnErrorDrop:
+	default:
+		return errors.New(fmt.Sprintf("unknown error policy '%s' of transformation '%s'", policy, name))
+	}
+
+	var found = false
+	for _, transform := range r.transforms {
+		if strings.EqualFold(transform.Name, name) {
+			transform.OnError = policy
+			found = true
+		}
+	}
+
+	if !found {
+		return errors.New(fmt.Sprintf("unknown transformation '%s'", name))
+	}
+	return nil
+}
+
 func (r *Registry) ApplyTransforms(data map[string]any) (map[string]any, error) {
+	return r.ApplyMessageTransforms(nil, data)
+}
+
+// ApplyMessageTransforms applies all transformations to the document of the given message. Transformations may drop
+// the message by returning ErrMessageDropped, which is returned regardless of their error policy.
+func (r *Registry) ApplyMessageTransforms(message *sarama.ConsumerMessage, data map[string]any) (map[string]any, error) {
 	var current = data
-	var err error
 	for _, transform := range r.transforms {
-		current, err = transform(current)
-		if err != nil {
+		var start = time.Now()
+		var transformed, err = transform.apply(message, current)
+		metrics.RecordTransform(transform.Name, time.Since(start))
+
+		if err == nil {
+			current = transformed
+			continue
+		}
+
+		if errors.Is(err, ErrMessageDropped) {
 			return nil, err
 		}
+
+		metrics.RecordTransformError(transform.Name, transform.OnError)
+		switch transform.OnError {
+
+		case OnErrorSkip:
+			log.Warn().Err(err).Str("transform", transform.Name).Msg("Could not apply transformation. Skipping it!")
+
+		case OnErrorDrop:
+			return nil, fmt.Errorf("%w by transformation '%s': %w", ErrMessageDropped, transform.Name, err)
+
+		default:
+			return nil, fmt.Errorf("transformation '%s' failed: %w", transform.Name, err)
+
+		}
 	}
 	return current, nil
 }
+
+// funcName returns the name of the function that created the given closure (e.g. "Flatten" for Flatten()).
+func funcName(transformFunc TransformFunc) string {
+	var name = runtime.FuncForPC(reflect.ValueOf(transformFunc).Pointer()).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+
+	var parts = strings.Split(name, ".")
+	if len(parts) > 1 {
+		return parts[1]
+	}
+	return name
+}
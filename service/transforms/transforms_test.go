@@ -6,12 +6,16 @@ package transforms_test
 
 import (
 	"encoding/json"
+	"errors"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"log"
 	"os"
 	"slices"
 	"testing"
+	"vortex/service/config"
 	"vortex/service/transforms"
+	"vortex/service/utils"
 )
 
 var (
@@ -42,6 +46,26 @@ func TestRegistry_ApplyTransforms(t *testing.T) {
 	}
 }
 
+func BenchmarkRegistry_ApplyTransforms(b *testing.B) {
+	var payload, err = os.ReadFile("../../testdata/kafka_msg.json")
+	if err != nil {
+		b.Fatal(err)
+	}
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var document map[string]any
+		if err := json.Unmarshal(payload, &document); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := transforms.GlobalRegistry.ApplyTransforms(document); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func createWorkingCopy(data map[string]any) map[string]any {
 	var copy = make(map[string]any)
 	for k, v := range data {
@@ -64,3 +88,94 @@ func mustReadJson(filename string) map[string]any {
 
 	return data
 }
+
+func TestNewDefaultRegistry_Separator(t *testing.T) {
+	var assertions = assert.New(t)
+	var options = utils.DefaultFlattenOptions()
+	options.Separator = "_"
+
+	transformed, err := transforms.NewDefaultRegistry(options).ApplyTransforms(mustReadJson("../../testdata/kafka_msg.json"))
+	assertions.Nil(err, "expected no error")
+	assertions.Contains(transformed, "event_id")
+	assertions.NotContains(transformed, "event_source", "expected flat keys to be deleted using the separator")
+	assertions.NotContains(transformed, "event_dataref", "expected flat keys to be deleted using the separator")
+}
+
+func TestConfigure_Unflatten(t *testing.T) {
+	var assertions = assert.New(t)
+	var registry = transforms.NewRegistry()
+	registry.Register(transforms.Flatten())
+
+	var err = transforms.Configure(registry, &config.Transforms{Unflatten: true})
+	assertions.Nil(err, "expected no error")
+
+	transformed, err := registry.ApplyTransforms(map[string]any{"event": map[string]any{"id": "1"}})
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(map[string]any{"event": map[string]any{"id": "1"}}, transformed)
+
+	err = transforms.Configure(registry, &config.Transforms{Unflatten: true, Flatten: config.Flatten{Arrays: "split"}})
+	assertions.NotNil(err, "expected unknown array strategy to be rejected")
+}
+
+func TestRegistry_ErrorPolicies(t *testing.T) {
+	var assertions = assert.New(t)
+	var failing = func(data map[string]any) (map[string]any, error) {
+		return nil, errors.New("broken")
+	}
+	var marking = func(data map[string]any) (map[string]any, error) {
+		data["marked"] = true
+		return data, nil
+	}
+
+	var registry = transforms.NewRegistry()
+	registry.RegisterTransforms(
+		transforms.NewTransform("Failing", failing),
+		transforms.NewTransform("Marking", marking),
+	)
+
+	_, err := registry.ApplyTransforms(map[string]any{})
+	assertions.EqualError(err, "transformation 'Failing' failed: broken")
+	assertions.False(errors.Is(err, transforms.ErrMessageDropped), "expected message to fail")
+
+	assertions.Nil(registry.SetErrorPolicy("failing", transforms.OnErrorSkip))
+	transformed, err := registry.ApplyTransforms(map[string]any{})
+	assertions.Nil(err, "expected failing transformation to be skipped")
+	assertions.Equal(map[string]any{"marked": true}, transformed)
+
+	assertions.Nil(registry.SetErrorPolicy("Failing", transforms.OnErrorDrop))
+	_, err = registry.ApplyTransforms(map[string]any{})
+	assertions.True(errors.Is(err, transforms.ErrMessageDropped), "expected message to be dropped")
+
+	assertions.NotNil(registry.SetErrorPolicy("Missing", transforms.OnErrorSkip), "expected unknown transformation to be rejected")
+	assertions.NotNil(registry.SetErrorPolicy("Failing", "retry"), "expected unknown policy to be rejected")
+}
+
+func TestRegistry_Register(t *testing.T) {
+	var assertions = assert.New(t)
+	var registry = transforms.NewRegistry()
+	registry.Register(transforms.Flatten(), transforms.DropHttpHeaders())
+
+	assertions.Nil(registry.SetErrorPolicy("Flatten", transforms.OnErrorSkip), "expected transformation to be named after its constructor")
+	assertions.Nil(registry.SetErrorPolicy("DropHttpHeaders", transforms.OnErrorSkip), "expected transformation to be named after its constructor")
+}
+
+func TestConfigure_ErrorPolicies(t *testing.T) {
+	var assertions = assert.New(t)
+	var registry = transforms.NewDefaultRegistry(utils.DefaultFlattenOptions())
+
+	var err = transforms.Configure(registry, &config.Transforms{
+		Fields: []config.FieldTransform{
+			{Name: "nestedId", Operation: transforms.OperationSet, Path: "event.id.value", Value: 1, Stage: transforms.StageBefore},
+		},
+		ErrorPolicies: map[string]string{"nestedid": transforms.OnErrorDrop},
+	})
+	assertions.Nil(err, "expected no error")
+
+	_, err = registry.ApplyTransforms(mustReadJson("../../testdata/kafka_msg.json"))
+	assertions.True(errors.Is(err, transforms.ErrMessageDropped), "expected message to be dropped")
+
+	err = transforms.Configure(transforms.NewRegistry(), &config.Transforms{
+		ErrorPolicies: map[string]string{"Flatten": transforms.OnErrorSkip},
+	})
+	assertions.NotNil(err, "expected policy of unknown transformation to be rejected")
+}
@@ -0,0 +1,304 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package transforms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostModule is the name of the module providing the host functions plugins may import.
+const HostModule = "vortex"
+
+// wasmPageSize is the size of a page of WebAssembly memory.
+const wasmPageSize = 64 * 1024
+
+// WasmPlugin is a transformation compiled to WebAssembly. Plugins have to be built as reactors (e.g. with
+// -buildmode=c-shared) and follow this ABI:
+//
+//   - export "memory"
+//   - export "alloc(size u32) -> ptr u32", which reserves memory for the input document
+//   - export "transform(ptr u32, len u32) -> u64", which receives the JSON document and returns the modified
+//     JSON document as (ptr << 32 | len)
+//   - optionally export "free(ptr u32, len u32)", which is called for the input and output after each call
+//   - optionally import "vortex.fail(ptr u32, len u32)" to fail the transformation with the given message
+//
+// A plugin instance is reused across calls and re-instantiated once a call has exceeded its timeout.
+type WasmPlugin struct {
+	Name string
+
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	timeout  time.Duration
+
+	mutex    sync.Mutex
+	instance api.Module
+	failure  string
+}
+
+// WasmRuntime compiles and runs plugins with a common memory limit.
+type WasmRuntime struct {
+	runtime wazero.Runtime
+}
+
+type pluginContextKey struct{}
+
+func NewWasmRuntime(memoryLimitMb int) (*WasmRuntime, error) {
+	var ctx = context.Background()
+	var runtimeConfig = wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	if memoryLimitMb > 0 {
+		runtimeConfig = runtimeConfig.WithMemoryLimitPages(uint32(memoryLimitMb * 1024 * 1024 / wasmPageSize))
+	}
+
+	var runtime = wazero.NewRuntimeWithConfig(ctx, runtimeConfig)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		_ = runtime.Close(ctx)
+		return nil, err
+	}
+
+	var _, err = runtime.NewHostModuleBuilder(HostModule).
+		NewFunctionBuilder().WithFunc(fail).Export("fail").
+		Instantiate(ctx)
+	if err != nil {
+		_ = runtime.Close(ctx)
+		return nil, err
+	}
+
+	return &WasmRuntime{runtime: runtime}, nil
+}
+
+// LoadDirectory compiles all plugins (*.wasm) of the given directory in the order of their file names.
+func (r *WasmRuntime) LoadDirectory(directory string, timeout time.Duration) ([]*WasmPlugin, error) {
+	var files, err = filepath.Glob(filepath.Join(directory, "*.wasm"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(files)
+
+	var plugins = make([]*WasmPlugin, 0, len(files))
+	for _, file := range files {
+		plugin, err := r.Load(file, timeout)
+		if err != nil {
+			return nil, err
+		}
+		plugins = append(plugins, plugin)
+	}
+	return plugins, nil
+}
+
+// Load compiles a plugin, which is named after its file without extension.
+func (r *WasmRuntime) Load(file string, timeout time.Duration) (*WasmPlugin, error) {
+	var binary, err = os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read plugin: %w", err)
+	}
+
+	var name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	compiled, err := r.runtime.CompileModule(context.Background(), binary)
+	if err != nil {
+		return nil, fmt.Errorf("could not compile plugin '%s': %w", name, err)
+	}
+
+	var exports = compiled.ExportedFunctions()
+	for _, required := range []string{"alloc", "transform"} {
+		if _, ok := exports[required]; !ok {
+			return nil, errors.New(fmt.Sprintf("plugin '%s' does not export function '%s'", name, required))
+		}
+	}
+
+	var plugin = &WasmPlugin{Name: name, runtime: r.runtime, compiled: compiled, timeout: timeout}
+	log.Info().Str("plugin", name).Msg("Loaded transformation plugin")
+	return plugin, nil
+}
+
+func (r *WasmRuntime) Close() {
+	if err := r.runtime.Close(context.Background()); err != nil {
+		log.Error().Err(err).Msg("Could not close plugin runtime")
+	}
+}
+
+// fail is the host function plugins call to report an error. The failure is recorded on the calling plugin,
+// which is passed along in the context of the call.
+func fail(ctx context.Context, module api.Module, ptr uint32, length uint32) {
+	var message, _ = module.Memory().Read(ptr, length)
+	if plugin, ok := ctx.Value(pluginContextKey{}).(*WasmPlugin); ok {
+		plugin.failure = string(message)
+	}
+}
+
+// TransformFunc returns the plugin as transformation.
+func (p *WasmPlugin) TransformFunc() TransformFunc {
+	return func(data map[string]any) (map[string]any, error) {
+		var input, err = json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+
+		output, err := p.Call(input)
+		if err != nil {
+			return nil, err
+		}
+
+		var transformed map[string]any
+		var decoder = json.NewDecoder(bytes.NewReader(output))
+		decoder.UseNumber()
+		if err := decoder.Decode(&transformed); err != nil {
+			return nil, fmt.Errorf("plugin '%s' returned an invalid document: %w", p.Name, err)
+		}
+		return restoreTypes(data, transformed).(map[string]any), nil
+	}
+}
+
+// restoreTypes replaces the values a plugin left unchanged by the values of the original document, since types such
+// as time.Time, Decimal128 or int64 do not survive the JSON round trip. Other numbers are decoded as int64 if they are
+// integral and as float64 otherwise. Values changed by the plugin are kept as they are.
+func restoreTypes(original any, transformed any) any {
+	switch casted := transformed.(type) {
+
+	case map[string]any:
+		// e.g. Decimal128 is encoded as object
+		if unchanged(original, transformed) {
+			return original
+		}
+
+		var originalMap, _ = original.(map[string]any)
+		for key, value := range casted {
+			casted[key] = restoreTypes(originalMap[key], value)
+		}
+		return casted
+
+	case []any:
+		var originalSlice, _ = original.([]any)
+		for i, value := range casted {
+			var originalValue any
+			if i < len(originalSlice) {
+				originalValue = originalSlice[i]
+			}
+			casted[i] = restoreTypes(originalValue, value)
+		}
+		return casted
+
+	default:
+		if unchanged(original, transformed) {
+			return original
+		}
+
+		if number, ok := transformed.(json.Number); ok {
+			if integer, err := number.Int64(); err == nil {
+				return integer
+			}
+			var float, _ = number.Float64()
+			return float
+		}
+		return transformed
+
+	}
+}
+
+// unchanged reports whether the original value is a scalar whose JSON encoding matches the transformed value.
+func unchanged(original any, transformed any) bool {
+	switch original.(type) {
+	case nil, map[string]any, []any, string, bool:
+		return false
+	}
+
+	var originalJson, err = json.Marshal(original)
+	if err != nil {
+		return false
+	}
+	transformedJson, err := json.Marshal(transformed)
+	return err == nil && bytes.Equal(originalJson, transformedJson)
+}
+
+// Call passes the input to the transform function of the plugin and returns its output.
+func (p *WasmPlugin) Call(input []byte) ([]byte, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.instance == nil || p.instance.IsClosed() {
+		var moduleConfig = wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize")
+		var instance, err = p.runtime.InstantiateModule(context.Background(), p.compiled, moduleConfig)
+		if err != nil {
+			return nil, fmt.Errorf("could not instantiate plugin '%s': %w", p.Name, err)
+		}
+		p.instance = instance
+	}
+
+	var ctx, cancel = context.WithValue(context.Background(), pluginContextKey{}, p), context.CancelFunc(func() {})
+	if p.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+	}
+	defer cancel()
+
+	p.failure = ""
+	var output, err = p.call(ctx, input)
+	if err == nil && len(p.failure) > 0 {
+		return nil, errors.New(fmt.Sprintf("plugin '%s' failed: %s", p.Name, p.failure))
+	}
+
+	if err != nil {
+		// the state of an instance is undefined after a trap, so it is replaced on the next call
+		_ = p.instance.Close(context.Background())
+		p.instance = nil
+
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("plugin '%s' exceeded its timeout of %s", p.Name, p.timeout)
+		}
+	}
+	return output, err
+}
+
+func (p *WasmPlugin) call(ctx context.Context, input []byte) ([]byte, error) {
+	var memory = p.instance.Memory()
+	var free = p.instance.ExportedFunction("free")
+
+	var results, err = p.instance.ExportedFunction("alloc").Call(ctx, uint64(len(input)))
+	if err != nil {
+		return nil, fmt.Errorf("plugin '%s' could not allocate memory: %w", p.Name, err)
+	}
+
+	var inputPtr = uint32(results[0])
+	if !memory.Write(inputPtr, input) {
+		return nil, errors.New(fmt.Sprintf("plugin '%s' allocated memory out of range", p.Name))
+	}
+
+	results, err = p.instance.ExportedFunction("transform").Call(ctx, uint64(inputPtr), uint64(len(input)))
+	if free != nil {
+		_, _ = free.Call(ctx, uint64(inputPtr), uint64(len(input)))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("plugin '%s' failed: %w", p.Name, err)
+	}
+
+	if len(p.failure) > 0 {
+		return nil, nil
+	}
+
+	var outputPtr, outputLen = uint32(results[0] >> 32), uint32(results[0])
+	var output, ok = memory.Read(outputPtr, outputLen)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("plugin '%s' returned memory out of range", p.Name))
+	}
+
+	// the view of the memory is only valid until the next call, so the output is copied before it is freed
+	output = slices.Clone(output)
+	if free != nil {
+		_, _ = free.Call(ctx, uint64(outputPtr), uint64(outputLen))
+	}
+	return output, nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package transforms_test
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+	"vortex/service/config"
+	"vortex/service/transforms"
+)
+
+// buildPlugin compiles the plugin of testdata/plugins, which requires a Go toolchain supporting go:wasmexport.
+func buildPlugin(t *testing.T, name string) string {
+	var directory = t.TempDir()
+	var command = exec.Command("go", "build", "-buildmode=c-shared", "-o", filepath.Join(directory, name+".wasm"), ".")
+	command.Dir = filepath.Join("../../testdata/plugins", name)
+	command.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm", "GOFLAGS=")
+
+	if output, err := command.CombinedOutput(); err != nil {
+		t.Skipf("could not build plugin '%s': %s", name, output)
+	}
+	return directory
+}
+
+func TestWasmPlugin(t *testing.T) {
+	var assertions = assert.New(t)
+	var directory = buildPlugin(t, "enrich")
+
+	runtime, err := transforms.NewWasmRuntime(64)
+	assertions.Nil(err, "expected no error")
+	defer runtime.Close()
+
+	plugins, err := runtime.LoadDirectory(directory, time.Second)
+	assertions.Nil(err, "expected no error")
+	assertions.Len(plugins, 1)
+	assertions.Equal("enrich", plugins[0].Name)
+
+	var transformFunc = plugins[0].TransformFunc()
+	for i := 0; i < 3; i++ {
+		transformed, err := transformFunc(map[string]any{"status": "DELIVERED"})
+		assertions.Nil(err, "expected no error")
+		assertions.Equal(map[string]any{"status": "DELIVERED", "enrichedBy": "wasm"}, transformed)
+	}
+
+	var modified = time.Date(2024, 1, 3, 6, 10, 35, 592000000, time.UTC)
+	var price, _ = primitive.ParseDecimal128("12.50")
+	transformed, err := transformFunc(map[string]any{
+		"modified":   modified,
+		"price":      price,
+		"retries":    int64(1704262235592),
+		"ratio":      0.5,
+		"properties": map[string]any{"timestamps": []any{modified}},
+	})
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(map[string]any{
+		"modified":   modified,
+		"price":      price,
+		"retries":    int64(1704262235592),
+		"ratio":      0.5,
+		"properties": map[string]any{"timestamps": []any{modified}},
+		"enrichedBy": "wasm",
+	}, transformed, "expected unchanged values to keep their types")
+
+	_, err = transformFunc(map[string]any{"mode": "fail"})
+	assertions.EqualError(err, "plugin 'enrich' failed: refusing document")
+
+	var start = time.Now()
+	_, err = transformFunc(map[string]any{"mode": "loop"})
+	assertions.EqualError(err, "plugin 'enrich' exceeded its timeout of 1s")
+	assertions.Less(time.Since(start), 5*time.Second, "expected plugin to be stopped")
+
+	_, err = transformFunc(map[string]any{"mode": "exhaust"})
+	assertions.NotNil(err, "expected memory limit to be enforced")
+
+	transformed, err = transformFunc(map[string]any{"status": "DELIVERED"})
+	assertions.Nil(err, "expected plugin to recover by re-instantiation")
+	assertions.Equal("wasm", transformed["enrichedBy"])
+}
+
+func TestRestoreTypes(t *testing.T) {
+	var modified = time.Date(2024, 1, 3, 6, 10, 35, 0, time.UTC)
+	var restored = transforms.RestoreTypes(
+		map[string]any{"modified": modified, "created": modified, "count": int64(2)},
+		map[string]any{"modified": "2024-01-03T06:10:35Z", "created": "yesterday", "count": json.Number("3"), "ratio": json.Number("1.5")},
+	)
+
+	assert.Equal(t, map[string]any{
+		"modified": modified,
+		"created":  "yesterday",
+		"count":    int64(3),
+		"ratio":    1.5,
+	}, restored, "expected changed values to be kept and numbers to be decoded as int64 or float64")
+}
+
+func TestConfigure_Plugins(t *testing.T) {
+	var assertions = assert.New(t)
+	var directory = buildPlugin(t, "enrich")
+	defer transforms.ClosePlugins()
+
+	var registry = transforms.NewRegistry()
+	var err = transforms.Configure(registry, &config.Transforms{
+		Plugins: config.Plugins{Directory: directory, TimeoutMs: 1000, MemoryLimitMb: 64, Stage: transforms.StageBefore},
+	})
+	assertions.Nil(err, "expected no error")
+
+	transformed, err := registry.ApplyTransforms(map[string]any{"status": "DELIVERED"})
+	assertions.Nil(err, "expected no error")
+	assertions.Equal("wasm", transformed["enrichedBy"])
+	assertions.Nil(registry.SetErrorPolicy("plugin:enrich", transforms.OnErrorSkip), "expected plugin to be named after its file")
+}
+
+func TestLoadDirectory_InvalidPlugin(t *testing.T) {
+	var assertions = assert.New(t)
+	var directory = t.TempDir()
+	assertions.Nil(os.WriteFile(filepath.Join(directory, "broken.wasm"), []byte("not wasm"), 0600))
+
+	runtime, err := transforms.NewWasmRuntime(16)
+	assertions.Nil(err, "expected no error")
+	defer runtime.Close()
+
+	_, err = runtime.LoadDirectory(directory, time.Second)
+	assertions.NotNil(err, "expected invalid plugin to be rejected")
+}
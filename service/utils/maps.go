@@ -5,32 +5,249 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
 	"strings"
 )
 
+const (
+	ArraysKeep  = "keep"
+	ArraysIndex = "index"
+	ArraysJoin  = "join"
+)
+
+// FlattenOptions control how nested documents are flattened.
+//
+// MaxDepth limits the amount of nested levels merged into a key, so that deeper objects stay nested (0 is unlimited).
+// If Include is set, only objects at or on the way to one of its prefixes are flattened, whereas objects at one of
+// the prefixes of Exclude always stay nested. Arrays are either kept as they are, flattened with their indices as keys
+// (e.g. "items.0.id") or, if they only contain scalars, joined to a single string using JoinSeparator.
+type FlattenOptions struct {
+	Separator     string
+	MaxDepth      int
+	Include       []string
+	Exclude       []string
+	Arrays        string
+	JoinSeparator string
+}
+
+func DefaultFlattenOptions() FlattenOptions {
+	return FlattenOptions{
+		Separator:     ".",
+		Arrays:        ArraysKeep,
+		JoinSeparator: ",",
+	}
+}
+
+// Validate returns an error if the options cannot be used for flattening.
+func (o FlattenOptions) Validate() error {
+	if len(o.Separator) == 0 {
+		return errors.New("separator must not be empty")
+	}
+
+	if o.MaxDepth < 0 {
+		return errors.New(fmt.Sprintf("max depth must not be negative but is %d", o.MaxDepth))
+	}
+
+	switch o.Arrays {
+	case ArraysKeep, ArraysIndex, ArraysJoin:
+	default:
+		return errors.New(fmt.Sprintf("unknown array strategy '%s'", o.Arrays))
+	}
+	return nil
+}
+
 func Flatten(data map[string]any, prefix string) map[string]any {
+	return FlattenWithOptions(data, prefix, DefaultFlattenOptions())
+}
+
+func FlattenWithOptions(data map[string]any, prefix string, options FlattenOptions) map[string]any {
 	var flatMap = make(map[string]any)
+	var depth = 0
+	if len(prefix) > 0 {
+		depth = strings.Count(prefix, options.Separator) + 1
+	}
 
 	for key, value := range data {
-		var fullKey string
+		options.flattenValue(flatMap, options.join(prefix, key), value, depth)
+	}
+
+	return flatMap
+}
+
+func (o FlattenOptions) flattenValue(flatMap map[string]any, key string, value any, depth int) {
+	switch casted := value.(type) {
+
+	case map[string]any:
+		if !o.descends(key, depth) {
+			flatMap[key] = value
+			return
+		}
+
+		for subKey, subValue := range casted {
+			o.flattenValue(flatMap, o.join(key, subKey), subValue, depth+1)
+		}
+
+	case []any:
+		switch o.Arrays {
+
+		case ArraysIndex:
+			if !o.descends(key, depth) || len(casted) == 0 {
+				flatMap[key] = value
+				return
+			}
+
+			for index, element := range casted {
+				o.flattenValue(flatMap, o.join(key, strconv.Itoa(index)), element, depth+1)
+			}
+
+		case ArraysJoin:
+			if joined, ok := joinScalars(casted, o.JoinSeparator); ok {
+				flatMap[key] = joined
+				return
+			}
+			flatMap[key] = value
+
+		default:
+			flatMap[key] = value
+
+		}
+
+	default:
+		flatMap[key] = value
+
+	}
+}
+
+func (o FlattenOptions) descends(key string, depth int) bool {
+	if o.MaxDepth > 0 && depth >= o.MaxDepth {
+		return false
+	}
+
+	for _, prefix := range o.Exclude {
+		if o.hasPrefix(key, prefix) {
+			return false
+		}
+	}
+
+	if len(o.Include) == 0 {
+		return true
+	}
+
+	for _, prefix := range o.Include {
+		if o.hasPrefix(key, prefix) || o.hasPrefix(prefix, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o FlattenOptions) hasPrefix(key string, prefix string) bool {
+	return key == prefix || strings.HasPrefix(key, prefix+o.Separator)
+}
+
+func (o FlattenOptions) join(prefix string, key string) string {
+	if len(prefix) == 0 {
+		return key
+	}
+	return prefix + o.Separator + key
+}
+
+func joinScalars(values []any, separator string) (string, bool) {
+	var parts = make([]string, len(values))
+	for i, value := range values {
+		switch value.(type) {
+		case map[string]any, []any, nil:
+			return "", false
+		default:
+			parts[i] = fmt.Sprint(value)
+		}
+	}
+	return strings.Join(parts, separator), true
+}
+
+// Unflatten is the inverse of FlattenWithOptions. Keys are split at the separator and nested into objects.
+// If arrays were flattened with their indices, objects whose keys are exactly the indices 0..n-1 are restored as arrays.
+// Joined arrays cannot be restored. An error is returned if a key is both a value and the prefix of another key.
+func Unflatten(data map[string]any, options FlattenOptions) (map[string]any, error) {
+	var keys = make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
 
-		var keyBuilder = strings.Builder{}
-		if len(prefix) > 0 {
-			keyBuilder.WriteString(prefix)
-			keyBuilder.WriteRune('.')
+	var nested = make(map[string]any)
+	for _, key := range keys {
+		var parts = strings.Split(key, options.Separator)
+		var current = nested
+
+		for i, part := range parts[:len(parts)-1] {
+			var child, exists = current[part]
+			if !exists {
+				child = make(map[string]any)
+				current[part] = child
+			}
+
+			var childMap, ok = child.(map[string]any)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("could not unflatten key '%s': '%s' is not an object", key, strings.Join(parts[:i+1], options.Separator)))
+			}
+			current = childMap
 		}
-		keyBuilder.WriteString(key)
-		fullKey = keyBuilder.String()
 
-		if subMap, ok := value.(map[string]any); ok {
-			var subFlatMap = Flatten(subMap, fullKey)
-			for subKey, subValue := range subFlatMap {
-				flatMap[subKey] = subValue
+		var last = parts[len(parts)-1]
+		if existing, exists := current[last]; exists {
+			var existingMap, isMap = existing.(map[string]any)
+			var valueMap, valueIsMap = data[key].(map[string]any)
+			if !isMap || !valueIsMap {
+				return nil, errors.New(fmt.Sprintf("could not unflatten key '%s': it conflicts with another key", key))
+			}
+
+			for subKey, subValue := range valueMap {
+				existingMap[subKey] = subValue
 			}
+			continue
+		}
+
+		if valueMap, ok := data[key].(map[string]any); ok {
+			current[last] = maps.Clone(valueMap)
 		} else {
-			flatMap[fullKey] = value
+			current[last] = data[key]
 		}
 	}
 
-	return flatMap
+	if options.Arrays == ArraysIndex {
+		for key, value := range nested {
+			nested[key] = restoreArrays(value)
+		}
+	}
+	return nested, nil
+}
+
+func restoreArrays(value any) any {
+	var object, ok = value.(map[string]any)
+	if !ok {
+		return value
+	}
+
+	for key, child := range object {
+		object[key] = restoreArrays(child)
+	}
+
+	if len(object) == 0 {
+		return object
+	}
+
+	var array = make([]any, len(object))
+	for key, child := range object {
+		var index, err = strconv.Atoi(key)
+		if err != nil || index < 0 || index >= len(array) || strconv.Itoa(index) != key {
+			return object
+		}
+		array[index] = child
+	}
+	return array
 }
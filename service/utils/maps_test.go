@@ -5,12 +5,14 @@
 package utils_test
 
 import (
-	"log"
+	"fmt"
+	"github.com/stretchr/testify/assert"
 	"testing"
 	"vortex/service/utils"
 )
 
 func TestFlatten(t *testing.T) {
+	var assertions = assert.New(t)
 	var input = map[string]any{
 		"hello": "world",
 		"foo": map[string]any{
@@ -18,14 +20,180 @@ func TestFlatten(t *testing.T) {
 				"fizz": "buzz",
 			},
 		},
+		"list": []any{"a", "b"},
 	}
 
 	var expectation = map[string]any{
 		"hello":        "world",
 		"foo.bar.fizz": "buzz",
+		"list":         []any{"a", "b"},
 	}
 
-	log.Printf("%+v\n", input)
-	log.Printf("%+v\n", expectation)
-	log.Printf("%+v\n", utils.Flatten(input, ""))
+	assertions.Equal(expectation, utils.Flatten(input, ""))
+	assertions.Equal(map[string]any{"root.hello": "world"}, utils.Flatten(map[string]any{"hello": "world"}, "root"))
+}
+
+func TestFlattenWithOptions(t *testing.T) {
+	var input = func() map[string]any {
+		return map[string]any{
+			"event": map[string]any{
+				"id":   "1",
+				"data": map[string]any{"nested": map[string]any{"value": 1.0}},
+			},
+			"headers": map[string]any{"accept": []any{"json", "xml"}},
+			"items":   []any{map[string]any{"id": "a"}, map[string]any{"id": "b"}},
+		}
+	}
+
+	var tests = []struct {
+		name     string
+		options  func(options *utils.FlattenOptions)
+		expected map[string]any
+	}{
+		{
+			name:    "separator",
+			options: func(options *utils.FlattenOptions) { options.Separator = "_" },
+			expected: map[string]any{
+				"event_id":                "1",
+				"event_data_nested_value": 1.0,
+				"headers_accept":          []any{"json", "xml"},
+				"items":                   []any{map[string]any{"id": "a"}, map[string]any{"id": "b"}},
+			},
+		},
+		{
+			name:    "max depth",
+			options: func(options *utils.FlattenOptions) { options.MaxDepth = 1 },
+			expected: map[string]any{
+				"event.id":       "1",
+				"event.data":     map[string]any{"nested": map[string]any{"value": 1.0}},
+				"headers.accept": []any{"json", "xml"},
+				"items":          []any{map[string]any{"id": "a"}, map[string]any{"id": "b"}},
+			},
+		},
+		{
+			name:    "exclude",
+			options: func(options *utils.FlattenOptions) { options.Exclude = []string{"event.data", "headers"} },
+			expected: map[string]any{
+				"event.id":   "1",
+				"event.data": map[string]any{"nested": map[string]any{"value": 1.0}},
+				"headers":    map[string]any{"accept": []any{"json", "xml"}},
+				"items":      []any{map[string]any{"id": "a"}, map[string]any{"id": "b"}},
+			},
+		},
+		{
+			name:    "include",
+			options: func(options *utils.FlattenOptions) { options.Include = []string{"event.data"} },
+			expected: map[string]any{
+				"event.id":                "1",
+				"event.data.nested.value": 1.0,
+				"headers":                 map[string]any{"accept": []any{"json", "xml"}},
+				"items":                   []any{map[string]any{"id": "a"}, map[string]any{"id": "b"}},
+			},
+		},
+		{
+			name:    "index arrays",
+			options: func(options *utils.FlattenOptions) { options.Arrays = utils.ArraysIndex },
+			expected: map[string]any{
+				"event.id":                "1",
+				"event.data.nested.value": 1.0,
+				"headers.accept.0":        "json",
+				"headers.accept.1":        "xml",
+				"items.0.id":              "a",
+				"items.1.id":              "b",
+			},
+		},
+		{
+			name: "join arrays",
+			options: func(options *utils.FlattenOptions) {
+				options.Arrays = utils.ArraysJoin
+				options.JoinSeparator = ";"
+			},
+			expected: map[string]any{
+				"event.id":                "1",
+				"event.data.nested.value": 1.0,
+				"headers.accept":          "json;xml",
+				"items":                   []any{map[string]any{"id": "a"}, map[string]any{"id": "b"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var options = utils.DefaultFlattenOptions()
+			test.options(&options)
+			assert.Nil(t, options.Validate(), "expected options to be valid")
+			assert.Equal(t, test.expected, utils.FlattenWithOptions(input(), "", options))
+		})
+	}
+}
+
+func TestFlattenOptions_Validate(t *testing.T) {
+	var assertions = assert.New(t)
+
+	var options = utils.DefaultFlattenOptions()
+	options.Separator = ""
+	assertions.NotNil(options.Validate(), "expected empty separator to be rejected")
+
+	options = utils.DefaultFlattenOptions()
+	options.MaxDepth = -1
+	assertions.NotNil(options.Validate(), "expected negative depth to be rejected")
+
+	options = utils.DefaultFlattenOptions()
+	options.Arrays = "split"
+	assertions.NotNil(options.Validate(), "expected unknown array strategy to be rejected")
+}
+
+func TestUnflatten(t *testing.T) {
+	var assertions = assert.New(t)
+	var options = utils.DefaultFlattenOptions()
+	options.Arrays = utils.ArraysIndex
+
+	var nested = map[string]any{
+		"event": map[string]any{
+			"id":   "1",
+			"data": map[string]any{"value": 1.0},
+		},
+		"items":  []any{map[string]any{"id": "a"}, map[string]any{"id": "b"}},
+		"sparse": map[string]any{"0": "a", "2": "c"},
+	}
+
+	var flat = utils.FlattenWithOptions(nested, "", options)
+	unflattened, err := utils.Unflatten(flat, options)
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(nested, unflattened, "expected unflatten to restore the nested document")
+
+	options.Arrays = utils.ArraysKeep
+	unflattened, err = utils.Unflatten(map[string]any{"items.0": "a"}, options)
+	assertions.Nil(err, "expected no error")
+	assertions.Equal(map[string]any{"items": map[string]any{"0": "a"}}, unflattened, "expected arrays to be restored only for index strategy")
+}
+
+func TestUnflatten_Conflict(t *testing.T) {
+	var assertions = assert.New(t)
+	var _, err = utils.Unflatten(map[string]any{"event": "1", "event.id": "2"}, utils.DefaultFlattenOptions())
+	assertions.EqualError(err, "could not unflatten key 'event.id': 'event' is not an object")
+}
+
+func BenchmarkFlatten_Deep(b *testing.B) {
+	var data = deepDocument(6, 4)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		utils.Flatten(data, "")
+	}
+}
+
+// deepDocument creates a document with the given amount of nested levels, each containing a scalar, an array and
+// the given amount of objects.
+func deepDocument(depth int, width int) map[string]any {
+	var document = map[string]any{"value": "scalar", "items": []any{1, 2, 3}}
+	if depth == 0 {
+		return document
+	}
+
+	for i := 0; i < width; i++ {
+		document[fmt.Sprintf("child%d", i)] = deepDocument(depth-1, width)
+	}
+	return document
 }
@@ -0,0 +1,336 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type segmentKind int
+
+const (
+	keySegment segmentKind = iota
+	indexSegment
+	wildcardSegment
+)
+
+type segment struct {
+	kind  segmentKind
+	key   string
+	index int
+}
+
+func (s segment) String() string {
+	switch s.kind {
+
+	case indexSegment:
+		return fmt.Sprintf("[%d]", s.index)
+
+	case wildcardSegment:
+		return "*"
+
+	default:
+		return s.key
+
+	}
+}
+
+// Path addresses values within a document using dotted keys, array indices and wildcards (e.g. "event.data.items[0].id",
+// "httpHeaders.*" or "items[*].id"). Negative indices count from the end of an array.
+//
+// Consecutive keys are matched greedily, so "event.id" resolves the key "event.id" of a flattened document
+// as well as the key "id" within the object "event" of a nested document.
+type Path struct {
+	raw      string
+	segments []segment
+}
+
+func ParsePath(path string) (*Path, error) {
+	if len(path) == 0 {
+		return nil, errors.New("path must not be empty")
+	}
+
+	var segments = make([]segment, 0)
+	for _, part := range strings.Split(path, ".") {
+		var key, rest, _ = strings.Cut(part, "[")
+		if len(key) == 0 && len(rest) == 0 {
+			return nil, errors.New(fmt.Sprintf("path '%s' contains an empty key", path))
+		}
+
+		if key == "*" {
+			segments = append(segments, segment{kind: wildcardSegment})
+		} else if len(key) > 0 {
+			segments = append(segments, segment{kind: keySegment, key: key})
+		}
+
+		if len(rest) == 0 {
+			continue
+		}
+
+		for _, index := range strings.Split(rest, "[") {
+			if !strings.HasSuffix(index, "]") {
+				return nil, errors.New(fmt.Sprintf("path '%s' contains an unterminated index", path))
+			}
+
+			index = strings.TrimSuffix(index, "]")
+			if index == "*" {
+				segments = append(segments, segment{kind: wildcardSegment})
+				continue
+			}
+
+			var parsed, err = strconv.Atoi(index)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("path '%s' contains an invalid index '%s'", path, index))
+			}
+			segments = append(segments, segment{kind: indexSegment, index: parsed})
+		}
+	}
+
+	return &Path{raw: path, segments: segments}, nil
+}
+
+func MustParsePath(path string) *Path {
+	var parsed, err = ParsePath(path)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func (p *Path) String() string {
+	return p.raw
+}
+
+// Match is a location within a document a path resolved to.
+type Match struct {
+	object map[string]any
+	array  []any
+	key    string
+	index  int
+}
+
+func (m Match) Value() any {
+	if m.object != nil {
+		return m.object[m.key]
+	}
+	return m.array[m.index]
+}
+
+func (m Match) Exists() bool {
+	if m.object != nil {
+		var _, ok = m.object[m.key]
+		return ok
+	}
+	return true
+}
+
+func (m Match) Set(value any) {
+	if m.object != nil {
+		m.object[m.key] = value
+		return
+	}
+	m.array[m.index] = value
+}
+
+// Delete removes the value from its object. Elements of arrays are set to nil, since the array cannot be resized in place.
+func (m Match) Delete() {
+	if m.object != nil {
+		delete(m.object, m.key)
+		return
+	}
+	m.array[m.index] = nil
+}
+
+// Find returns all existing values the path resolves to. It never fails, so missing fields or values of unexpected
+// types simply do not match.
+func (p *Path) Find(data map[string]any) []Match {
+	var matches = make([]Match, 0, 1)
+	_ = p.walk(data, p.segments, 0, false, &matches)
+	return matches
+}
+
+// Get returns the first value the path resolves to.
+func (p *Path) Get(data map[string]any) (any, bool) {
+	var matches = p.Find(data)
+	if len(matches) == 0 {
+		return nil, false
+	}
+	return matches[0].Value(), true
+}
+
+// Set sets the value at all locations the path resolves to. Missing objects are created on the way,
+// whereas an error is returned if an existing value on the way is not an object or array as expected.
+func (p *Path) Set(data map[string]any, value any) error {
+	var matches = make([]Match, 0, 1)
+	if err := p.walk(data, p.segments, 0, true, &matches); err != nil {
+		return err
+	}
+
+	for _, match := range matches {
+		match.Set(value)
+	}
+	return nil
+}
+
+// Delete deletes all values the path resolves to and returns how many were deleted.
+func (p *Path) Delete(data map[string]any) int {
+	var matches = p.Find(data)
+	for _, match := range matches {
+		match.Delete()
+	}
+	return len(matches)
+}
+
+func (p *Path) walk(node any, segments []segment, depth int, create bool, matches *[]Match) error {
+	var current = segments[0]
+	var last = len(segments) == 1
+
+	switch casted := node.(type) {
+
+	case map[string]any:
+		switch current.kind {
+
+		case keySegment:
+			for i := countKeys(segments); i > 0; i-- {
+				var key = joinKeys(segments[:i])
+				var value, ok = casted[key]
+				if !ok {
+					continue
+				}
+
+				if i == len(segments) {
+					*matches = append(*matches, Match{object: casted, key: key})
+					return nil
+				}
+				return p.walk(value, segments[i:], depth+i, create, matches)
+			}
+
+			if !create {
+				return nil
+			}
+
+			if last {
+				*matches = append(*matches, Match{object: casted, key: current.key})
+				return nil
+			}
+
+			if segments[1].kind != keySegment {
+				return p.errorAt(depth+1, "does not exist and cannot be created as array")
+			}
+
+			var child = make(map[string]any)
+			casted[current.key] = child
+			return p.walk(child, segments[1:], depth+1, create, matches)
+
+		case wildcardSegment:
+			var keys = make([]string, 0, len(casted))
+			for key := range casted {
+				keys = append(keys, key)
+			}
+			slices.Sort(keys)
+
+			for _, key := range keys {
+				if last {
+					*matches = append(*matches, Match{object: casted, key: key})
+				} else if err := p.walk(casted[key], segments[1:], depth+1, create, matches); err != nil {
+					return err
+				}
+			}
+			return nil
+
+		default:
+			return p.typeError(depth, create, "is an object, not an array")
+
+		}
+
+	case []any:
+		switch current.kind {
+
+		case indexSegment:
+			var index = current.index
+			if index < 0 {
+				index += len(casted)
+			}
+
+			if index < 0 || index >= len(casted) {
+				return p.typeError(depth, create, fmt.Sprintf("has no index %d", current.index))
+			}
+
+			if last {
+				*matches = append(*matches, Match{array: casted, index: index})
+				return nil
+			}
+			return p.walk(casted[index], segments[1:], depth+1, create, matches)
+
+		case wildcardSegment:
+			for index := range casted {
+				if last {
+					*matches = append(*matches, Match{array: casted, index: index})
+				} else if err := p.walk(casted[index], segments[1:], depth+1, create, matches); err != nil {
+					return err
+				}
+			}
+			return nil
+
+		default:
+			return p.typeError(depth, create, "is an array, not an object")
+
+		}
+
+	case nil:
+		return p.typeError(depth, create, "is null")
+
+	default:
+		return p.typeError(depth, create, fmt.Sprintf("is a %T, not an object or array", node))
+
+	}
+}
+
+// typeError only reports an error for writes, since reads are nil-safe by design.
+func (p *Path) typeError(depth int, create bool, reason string) error {
+	if !create {
+		return nil
+	}
+	return p.errorAt(depth, reason)
+}
+
+func (p *Path) errorAt(depth int, reason string) error {
+	var location = "the document"
+	if depth > 0 {
+		location = fmt.Sprintf("'%s'", joinSegments(p.segments[:depth]))
+	}
+	return errors.New(fmt.Sprintf("could not resolve path '%s': %s %s", p.raw, location, reason))
+}
+
+func countKeys(segments []segment) int {
+	var count = 0
+	for count < len(segments) && segments[count].kind == keySegment {
+		count++
+	}
+	return count
+}
+
+func joinKeys(segments []segment) string {
+	var keys = make([]string, len(segments))
+	for i, s := range segments {
+		keys[i] = s.key
+	}
+	return strings.Join(keys, ".")
+}
+
+func joinSegments(segments []segment) string {
+	var builder = strings.Builder{}
+	for i, s := range segments {
+		if i > 0 && s.kind != indexSegment {
+			builder.WriteRune('.')
+		}
+		builder.WriteString(s.String())
+	}
+	return builder.String()
+}
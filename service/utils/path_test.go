@@ -0,0 +1,93 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"vortex/service/utils"
+)
+
+func TestParsePath_Invalid(t *testing.T) {
+	var assertions = assert.New(t)
+	for _, path := range []string{"", "event..id", "items[0", "items[first]"} {
+		_, err := utils.ParsePath(path)
+		assertions.NotNil(err, "expected path '%s' to be invalid", path)
+	}
+}
+
+func TestPath_Get(t *testing.T) {
+	var assertions = assert.New(t)
+	var document = map[string]any{
+		"event": map[string]any{
+			"id": "1",
+			"data": map[string]any{
+				"items": []any{
+					map[string]any{"id": "a"},
+					map[string]any{"id": "b"},
+				},
+			},
+		},
+		"properties.callback-url": "https://example.com/callback",
+		"status":                  nil,
+	}
+
+	var cases = map[string]any{
+		"event.id":                "1",
+		"event.data.items[1].id":  "b",
+		"event.data.items[-1].id": "b",
+		"properties.callback-url": "https://example.com/callback",
+	}
+	for path, expected := range cases {
+		value, ok := utils.MustParsePath(path).Get(document)
+		assertions.True(ok, "expected path '%s' to exist", path)
+		assertions.Equal(expected, value, "expected value of path '%s' to match", path)
+	}
+
+	for _, path := range []string{"event.missing", "event.id.nested", "event.data.items[2]", "status.nested", "event[0]"} {
+		_, ok := utils.MustParsePath(path).Get(document)
+		assertions.False(ok, "expected path '%s' to not exist", path)
+	}
+
+	var matches = utils.MustParsePath("event.data.items[*].id").Find(document)
+	assertions.Len(matches, 2, "expected wildcard to match all items")
+	assertions.Equal("a", matches[0].Value())
+	assertions.Equal("b", matches[1].Value())
+
+	assertions.Len(utils.MustParsePath("event.*").Find(document), 2, "expected wildcard to match all keys")
+}
+
+func TestPath_Set(t *testing.T) {
+	var assertions = assert.New(t)
+	var document = map[string]any{
+		"event":  map[string]any{"id": "1"},
+		"items":  []any{map[string]any{}, map[string]any{}},
+		"status": "PROCESSED",
+	}
+
+	assertions.Nil(utils.MustParsePath("event.data.message").Set(document, "hello"))
+	assertions.Equal(map[string]any{"message": "hello"}, document["event"].(map[string]any)["data"], "expected missing objects to be created")
+
+	assertions.Nil(utils.MustParsePath("items[*].seen").Set(document, true))
+	assertions.Equal([]any{map[string]any{"seen": true}, map[string]any{"seen": true}}, document["items"])
+
+	var err = utils.MustParsePath("status.code").Set(document, 200)
+	assertions.EqualError(err, "could not resolve path 'status.code': 'status' is a string, not an object or array")
+
+	err = utils.MustParsePath("items[5].seen").Set(document, true)
+	assertions.EqualError(err, "could not resolve path 'items[5].seen': 'items' has no index 5")
+}
+
+func TestPath_Delete(t *testing.T) {
+	var assertions = assert.New(t)
+	var document = map[string]any{
+		"event": map[string]any{"id": "1", "data": "payload"},
+	}
+
+	assertions.Equal(1, utils.MustParsePath("event.data").Delete(document))
+	assertions.Equal(0, utils.MustParsePath("event.data").Delete(document), "expected deleting missing paths to be a no-op")
+	assertions.Equal(0, utils.MustParsePath("missing.data").Delete(document))
+	assertions.Equal(map[string]any{"event": map[string]any{"id": "1"}}, document)
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/rs/zerolog/log"
+	"github.com/xeipuuv/gojsonschema"
+	"path/filepath"
+	"vortex/service/config"
+	"vortex/service/dlq"
+	"vortex/service/metrics"
+	"vortex/service/utils"
+)
+
+// ErrorHeader is the record header carrying the validation error of messages forwarded to the dead letter queue.
+const ErrorHeader = "vortex-validation-error"
+
+// Violation describes why a message does not match its schema. Only the first error is reported.
+type Violation struct {
+	Schema string
+	Error  string
+}
+
+type schema struct {
+	name        string
+	topic       string
+	messageType string
+	compiled    *gojsonschema.Schema
+}
+
+// Validator checks payloads against the first configured JSON Schema matching the topic and type header of a message.
+// Messages without a matching schema are considered valid.
+type Validator struct {
+	schemas   []*schema
+	policy    string
+	dlqTopic  string
+	forwarder dlq.Forwarder
+}
+
+func NewValidator(validationConfig *config.Validation, forwarder dlq.Forwarder) (*Validator, error) {
+	switch validationConfig.Policy {
+
+	case dlq.PolicySkip, dlq.PolicyFail:
+
+	case dlq.PolicyDlq:
+		if len(validationConfig.DlqTopic) == 0 || forwarder == nil {
+			return nil, errors.New("forwarding invalid messages requires a dead letter topic")
+		}
+
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown validation policy '%s'", validationConfig.Policy))
+
+	}
+
+	var validator = &Validator{
+		schemas:   make([]*schema, 0, len(validationConfig.Schemas)),
+		policy:    validationConfig.Policy,
+		dlqTopic:  validationConfig.DlqTopic,
+		forwarder: forwarder,
+	}
+
+	for _, schemaConfig := range validationConfig.Schemas {
+		var path, err = filepath.Abs(schemaConfig.File)
+		if err != nil {
+			return nil, err
+		}
+
+		compiled, err := gojsonschema.NewSchema(gojsonschema.NewReferenceLoader("file://" + filepath.ToSlash(path)))
+		if err != nil {
+			return nil, fmt.Errorf("could not load schema '%s': %w", schemaConfig.File, err)
+		}
+
+		validator.schemas = append(validator.schemas, &schema{
+			name:        filepath.Base(schemaConfig.File),
+			topic:       schemaConfig.Topic,
+			messageType: schemaConfig.Type,
+			compiled:    compiled,
+		})
+	}
+	return validator, nil
+}
+
+// Validate returns the violation of the given document or nil if it is valid.
+func (v *Validator) Validate(message *sarama.ConsumerMessage, document map[string]any) *Violation {
+	if v == nil {
+		return nil
+	}
+
+	var messageType = utils.GetHeader(message.Headers, "type")
+	for _, s := range v.schemas {
+		if len(s.topic) > 0 && s.topic != message.Topic {
+			continue
+		}
+		if len(s.messageType) > 0 && s.messageType != messageType {
+			continue
+		}
+
+		var result, err = s.compiled.Validate(gojsonschema.NewGoLoader(document))
+		if err != nil {
+			return &Violation{Schema: s.name, Error: err.Error()}
+		}
+
+		if !result.Valid() {
+			return &Violation{Schema: s.name, Error: result.Errors()[0].String()}
+		}
+		return nil
+	}
+	return nil
+}
+
+// Reject handles an invalid message according to the policy. An error is returned if the message must not be
+// acknowledged, either because of the policy or because it could not be forwarded.
+func (v *Validator) Reject(message *sarama.ConsumerMessage, violation *Violation) error {
+	metrics.RecordInvalid(violation.Schema)
+	log.Warn().Fields(utils.GetFieldsFromMessage(message)).
+		Str("schema", violation.Schema).
+		Str("policy", v.policy).
+		Str("error", violation.Error).
+		Msg("Received invalid message")
+
+	switch v.policy {
+
+	case dlq.PolicyDlq:
+		var header = sarama.RecordHeader{Key: []byte(ErrorHeader), Value: []byte(violation.Error)}
+		if err := v.forwarder.Forward(v.dlqTopic, message, header); err != nil {
+			return fmt.Errorf("could not forward invalid message to '%s': %w", v.dlqTopic, err)
+		}
+		return nil
+
+	case dlq.PolicyFail:
+		return errors.New(fmt.Sprintf("invalid message according to schema '%s': %s", violation.Schema, violation.Error))
+
+	default:
+		return nil
+
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package validation_test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"vortex/service/config"
+	"vortex/service/dlq"
+	"vortex/service/validation"
+)
+
+var testMessage = &sarama.ConsumerMessage{
+	Topic:     "status",
+	Key:       []byte("9475695c-d29c-4a91-ba5c-62a9c5a867b5"),
+	Partition: 1,
+	Offset:    42,
+	Headers: []*sarama.RecordHeader{
+		{Key: []byte("type"), Value: []byte("MESSAGE")},
+	},
+}
+
+type forwarded struct {
+	topic   string
+	message *sarama.ConsumerMessage
+	headers []sarama.RecordHeader
+}
+
+type testForwarder struct {
+	forwarded []forwarded
+	err       error
+}
+
+func (f *testForwarder) Forward(topic string, message *sarama.ConsumerMessage, headers ...sarama.RecordHeader) error {
+	f.forwarded = append(f.forwarded, forwarded{topic, message, headers})
+	return f.err
+}
+
+func TestValidator_Validate(t *testing.T) {
+	var assertions = assert.New(t)
+	var validator, err = validation.NewValidator(&config.Validation{
+		Policy: dlq.PolicySkip,
+		Schemas: []config.Schema{
+			{Topic: "status", Type: "METADATA", File: "../../testdata/schemas/event.json"},
+			{Topic: "status", Type: "MESSAGE", File: "../../testdata/schemas/status.json"},
+		},
+	}, nil)
+	assertions.Nil(err, "expected no error")
+
+	var document = mustReadJson("../../testdata/kafka_msg.json")
+	assertions.Nil(validator.Validate(testMessage, document), "expected test message to be valid")
+
+	document["status"] = "UNKNOWN"
+	document["event"].(map[string]any)["id"] = 42.0
+	var violation = validator.Validate(testMessage, document)
+	assertions.NotNil(violation, "expected invalid message to be detected")
+	assertions.Equal("status.json", violation.Schema)
+	assertions.Contains([]string{
+		"event.id: Invalid type. Expected: string, given: integer",
+		"status: status must be one of the following: \"PROCESSED\", \"DELIVERING\", \"DELIVERED\", \"WAITING\", \"FAILED\", \"DROPPED\", \"DUPLICATE\"",
+	}, violation.Error, "expected first error to be reported")
+
+	var otherTopic = *testMessage
+	otherTopic.Topic = "other"
+	assertions.Nil(validator.Validate(&otherTopic, document), "expected messages without schema to be valid")
+
+	var nilValidator *validation.Validator
+	assertions.Nil(nilValidator.Validate(testMessage, document), "expected disabled validation to accept all messages")
+}
+
+func TestValidator_Reject(t *testing.T) {
+	var assertions = assert.New(t)
+	var violation = &validation.Violation{Schema: "status.json", Error: "uuid is required"}
+
+	skipping, err := validation.NewValidator(&config.Validation{Policy: dlq.PolicySkip}, nil)
+	assertions.Nil(err, "expected no error")
+	assertions.Nil(skipping.Reject(testMessage, violation), "expected skipped message to be acknowledged")
+
+	failing, err := validation.NewValidator(&config.Validation{Policy: dlq.PolicyFail}, nil)
+	assertions.Nil(err, "expected no error")
+	assertions.EqualError(failing.Reject(testMessage, violation), "invalid message according to schema 'status.json': uuid is required")
+
+	var forwarder = &testForwarder{}
+	forwarding, err := validation.NewValidator(&config.Validation{Policy: dlq.PolicyDlq, DlqTopic: "status-dlq"}, forwarder)
+	assertions.Nil(err, "expected no error")
+	assertions.Nil(forwarding.Reject(testMessage, violation), "expected forwarded message to be acknowledged")
+	assertions.Len(forwarder.forwarded, 1)
+	assertions.Equal("status-dlq", forwarder.forwarded[0].topic)
+	assertions.Equal(testMessage, forwarder.forwarded[0].message)
+	assertions.Equal([]sarama.RecordHeader{{Key: []byte(validation.ErrorHeader), Value: []byte("uuid is required")}}, forwarder.forwarded[0].headers)
+
+	forwarder.err = errors.New("broker unavailable")
+	assertions.NotNil(forwarding.Reject(testMessage, violation), "expected message not to be acknowledged if it could not be forwarded")
+}
+
+func TestNewValidator_Invalid(t *testing.T) {
+	var assertions = assert.New(t)
+
+	_, err := validation.NewValidator(&config.Validation{Policy: "retry"}, nil)
+	assertions.NotNil(err, "expected unknown policy to be rejected")
+
+	_, err = validation.NewValidator(&config.Validation{Policy: dlq.PolicyDlq, DlqTopic: "status-dlq"}, nil)
+	assertions.NotNil(err, "expected dead letter policy without producer to be rejected")
+
+	_, err = validation.NewValidator(&config.Validation{
+		Policy:  dlq.PolicySkip,
+		Schemas: []config.Schema{{File: "../../testdata/schemas/missing.json"}},
+	}, nil)
+	assertions.NotNil(err, "expected missing schema to be rejected")
+}
+
+func mustReadJson(filename string) map[string]any {
+	bytes, err := os.ReadFile(filename)
+	if err != nil {
+		panic(err)
+	}
+
+	var data = make(map[string]any)
+	if err := json.Unmarshal(bytes, &data); err != nil {
+		panic(err)
+	}
+
+	return data
+}
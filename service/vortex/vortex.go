@@ -5,38 +5,113 @@
 package vortex
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+	"vortex/service/archive"
 	"vortex/service/config"
+	"vortex/service/dlq"
+	"vortex/service/filter"
+	"vortex/service/identity"
 	"vortex/service/kafka"
 	"vortex/service/metrics"
 	"vortex/service/mongo"
+	"vortex/service/tracing"
+	"vortex/service/transforms"
+	"vortex/service/validation"
 
 	"github.com/rs/zerolog/log"
 )
 
 var (
-	source       *kafka.Consumer
+	source       messageSource
 	sink         *mongo.Connection
+	dlqProducer  *kafka.Producer
 	processGroup *sync.WaitGroup
 )
 
+// messageSource provides the messages processed by the pipeline.
+type messageSource interface {
+	mongo.Source
+	Start(processGroup *sync.WaitGroup)
+	Stop()
+}
+
 func StartPipeline(config config.Configuration) {
 	processGroup = new(sync.WaitGroup)
 	processGroup.Add(2)
 
 	var err error
 
-	var sourceCfg = config.Kafka
-	source, err = kafka.NewConsumer(&sourceCfg)
+	var tracingCfg = config.Tracing
+	if err := tracing.Init(&tracingCfg); err != nil {
+		log.Fatal().Err(err).Msg("Could not initialize tracing!")
+	}
+
+	source, err = newSource(&config)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Error while creating consumer!")
 	}
 
+	var transformsCfg = config.Transforms
+	flattenOptions, err := transforms.NewFlattenOptions(&transformsCfg.Flatten)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not configure transformations!")
+	}
+
+	transforms.GlobalRegistry = transforms.NewDefaultRegistry(flattenOptions)
+	if err := transforms.Configure(transforms.GlobalRegistry, &transformsCfg); err != nil {
+		log.Fatal().Err(err).Msg("Could not configure transformations!")
+	}
+
+	messageFilter, err := filter.NewFilter(config.Filters)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not compile filters!")
+	}
+
+	validator, err := newValidator(&config)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not load schemas!")
+	}
+
+	identities, err := newIdentities(&config)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not configure document identities!")
+	}
+
+	if !config.Mongo.Enabled && !config.Output.Enabled && !config.File.Enabled {
+		log.Fatal().Msg("Neither the database, the output topic nor the file sink is enabled!")
+	}
+
+	var outputs []mongo.Output
+	if config.Output.Enabled {
+		var outputCfg, kafkaCfg = config.Output, config.Kafka
+		output, err := kafka.NewSink(&outputCfg, &kafkaCfg, source)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Could not create output producer!")
+		}
+		outputs = append(outputs, output)
+	}
+
+	if config.File.Enabled {
+		var fileCfg = config.File
+		output, err := archive.NewSink(&fileCfg, source, mongo.DerivedFields(&config.Mongo)...)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Could not create file sink!")
+		}
+		outputs = append(outputs, output)
+	}
+
 	var sinkCfg = config.Mongo
-	sink, err = mongo.NewConnection(&sinkCfg, source)
+	if sinkCfg.TypedDecoding && !supportsTypedDecoding(&config, identities) {
+		log.Warn().Msg("Typed decoding is disabled, since it does not support filters, validation, custom transformations, custom identities, the output topic or the file sink")
+		sinkCfg.TypedDecoding = false
+	}
+
+	sink, err = mongo.NewConnection(&sinkCfg, source, messageFilter, validator, identities, outputs...)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Could not establish database connection!")
 	}
@@ -53,9 +128,96 @@ func StartPipeline(config config.Configuration) {
 func Terminate() {
 	source.Stop()
 	sink.Stop()
+	if dlqProducer != nil {
+		dlqProducer.Close()
+	}
+	transforms.ClosePlugins()
+	tracing.Shutdown()
 	os.Exit(0)
 }
 
+// newSource creates the Kafka consumer or the file source, which terminates Vortex once all of its messages have
+// been written.
+func newSource(config *config.Configuration) (messageSource, error) {
+	switch config.Source.Type {
+
+	case archive.TypeFile:
+		var fileSource, err = archive.NewSource(&config.Source, mongo.DerivedFields(&config.Mongo)...)
+		if err != nil {
+			return nil, err
+		}
+		go terminateOnCompletion(fileSource)
+		return fileSource, nil
+
+	case "kafka":
+		var consumer, err = kafka.NewConsumer(&config.Kafka)
+		if err != nil {
+			return nil, err
+		}
+		return consumer, nil
+
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown source type '%s'", config.Source.Type))
+
+	}
+}
+
+// newValidator creates the validator of incoming messages, which is nil if validation is disabled.
+func newValidator(config *config.Configuration) (*validation.Validator, error) {
+	if !config.Validation.Enabled {
+		return nil, nil
+	}
+
+	var forwarder dlq.Forwarder
+	if config.Validation.Policy == dlq.PolicyDlq {
+		var producer, err = newDlqProducer(config)
+		if err != nil {
+			return nil, err
+		}
+		forwarder = producer
+	}
+	return validation.NewValidator(&config.Validation, forwarder)
+}
+
+// newIdentities creates the identities of documents per route.
+func newIdentities(config *config.Configuration) (*identity.Routes, error) {
+	var forwarder dlq.Forwarder
+	if identity.UsesDlq(&config.Mongo.Identity, config.Filters) {
+		var producer, err = newDlqProducer(config)
+		if err != nil {
+			return nil, err
+		}
+		forwarder = producer
+	}
+	return identity.NewRoutes(&config.Mongo.Identity, config.Filters, forwarder)
+}
+
+// newDlqProducer returns the producer shared by all dead letter queues, which is created on first use.
+func newDlqProducer(config *config.Configuration) (*kafka.Producer, error) {
+	if dlqProducer != nil {
+		return dlqProducer, nil
+	}
+
+	var err error
+	dlqProducer, err = kafka.NewProducer(&config.Kafka)
+	return dlqProducer, err
+}
+
+// supportsTypedDecoding reports whether messages may be decoded into typed structs, which only apply the default
+// transformations, identify documents by key and event.id and set the whole document without writing it to any output.
+func supportsTypedDecoding(config *config.Configuration, identities *identity.Routes) bool {
+	return len(config.Filters) == 0 && !config.Validation.Enabled && transforms.IsDefault(&config.Transforms) &&
+		identities.IsDefault() && len(config.Mongo.Updates) == 0 &&
+		len(config.Mongo.SetOnInsert) == 0 && len(config.Mongo.Operators) == 0 && !config.Output.Enabled &&
+		!config.File.Enabled
+}
+
+func terminateOnCompletion(fileSource *archive.Source) {
+	<-fileSource.Completed()
+	log.Info().Msg("All messages of the source have been written")
+	Terminate()
+}
+
 func terminateOnSignal() {
 	var sigintChannel = make(chan os.Signal, 1)
 	signal.Notify(sigintChannel, syscall.SIGINT, syscall.SIGTERM)
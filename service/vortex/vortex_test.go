@@ -171,6 +171,10 @@ func TestStartPipeline(t *testing.T) {
 	config.Current = config.Configuration{
 		LogLevel: "debug",
 
+		Source: config.Source{
+			Type: "kafka",
+		},
+
 		Kafka: config.Kafka{
 			Brokers:           []string{kafkaHost},
 			GroupName:         "vortex",
@@ -179,6 +183,7 @@ func TestStartPipeline(t *testing.T) {
 		},
 
 		Mongo: config.Mongo{
+			Enabled:          true,
 			Url:              "mongodb://" + mongoHost,
 			BulkSize:         1,
 			Collection:       "vortex",
@@ -0,0 +1,73 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package main is a transformation plugin used in tests. It is built with
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o enrich.wasm .
+package main
+
+import (
+	"encoding/json"
+	"unsafe"
+)
+
+// buffers keeps memory passed to the host alive until it is freed.
+var buffers = make(map[uint32][]byte)
+
+//go:wasmimport vortex fail
+func fail(ptr uint32, length uint32)
+
+//go:wasmexport alloc
+func alloc(size uint32) uint32 {
+	var buffer = make([]byte, size)
+	var ptr = uint32(uintptr(unsafe.Pointer(unsafe.SliceData(buffer))))
+	buffers[ptr] = buffer
+	return ptr
+}
+
+//go:wasmexport free
+func free(ptr uint32, _ uint32) {
+	delete(buffers, ptr)
+}
+
+//go:wasmexport transform
+func transform(ptr uint32, length uint32) uint64 {
+	var document map[string]any
+	if err := json.Unmarshal(buffers[ptr][:length], &document); err != nil {
+		return failWith(err.Error())
+	}
+
+	switch document["mode"] {
+
+	case "fail":
+		return failWith("refusing document")
+
+	case "loop":
+		for {
+		}
+
+	case "exhaust":
+		var chunks [][]byte
+		for {
+			chunks = append(chunks, make([]byte, 1024*1024))
+		}
+
+	}
+
+	document["enrichedBy"] = "wasm"
+	var output, _ = json.Marshal(document)
+	var outputPtr = alloc(uint32(len(output)))
+	copy(buffers[outputPtr], output)
+	return uint64(outputPtr)<<32 | uint64(len(output))
+}
+
+func failWith(message string) uint64 {
+	var ptr = alloc(uint32(len(message)))
+	copy(buffers[ptr], message)
+	fail(ptr, uint32(len(message)))
+	free(ptr, 0)
+	return 0
+}
+
+func main() {}
@@ -0,0 +1,206 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Benchcheck compares the output of "go test -bench -benchmem" with a baseline and exits with a non-zero status if
+// a benchmark regressed by more than the given thresholds. Repeated runs of a benchmark (-count) are reduced to their
+// median. Benchmarks that only exist in one of the files are reported but never fail the check.
+//
+// Usage:
+//
+//	go run ./tools/benchcheck -baseline benchmarks/baseline.txt [-threshold 20] [-alloc-threshold 10] bench_output.txt
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	metricTime   = "ns/op"
+	metricBytes  = "B/op"
+	metricAllocs = "allocs/op"
+)
+
+// procsSuffix is the GOMAXPROCS suffix go test appends to benchmark names (e.g. "-8").
+var procsSuffix = regexp.MustCompile(`-\d+$`)
+
+// results maps the qualified name of a benchmark to the measured values per metric.
+type results map[string]map[string][]float64
+
+type regression struct {
+	name     string
+	metric   string
+	baseline float64
+	current  float64
+}
+
+func (r regression) String() string {
+	return fmt.Sprintf("%s: %s regressed from %g to %g (%+.1f%%)", r.name, r.metric, r.baseline, r.current, change(r.baseline, r.current))
+}
+
+func main() {
+	var baselineFile = flag.String("baseline", "benchmarks/baseline.txt", "the file containing the baseline results")
+	var threshold = flag.Float64("threshold", 20, "the tolerated increase of ns/op in percent (negative disables the check)")
+	var allocThreshold = flag.Float64("alloc-threshold", 10, "the tolerated increase of B/op and allocs/op in percent (negative disables the check)")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: benchcheck [flags] <current results>")
+		os.Exit(2)
+	}
+
+	var baseline, err = parseFile(*baselineFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not read baseline: %s\n", err)
+		os.Exit(2)
+	}
+
+	current, err := parseFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not read current results: %s\n", err)
+		os.Exit(2)
+	}
+
+	var thresholds = map[string]float64{
+		metricTime:   *threshold,
+		metricBytes:  *allocThreshold,
+		metricAllocs: *allocThreshold,
+	}
+
+	var regressions = compare(baseline, current, thresholds, os.Stdout)
+	if len(regressions) > 0 {
+		fmt.Println()
+		for _, regression := range regressions {
+			fmt.Println("REGRESSION " + regression.String())
+		}
+		os.Exit(1)
+	}
+}
+
+func parseFile(file string) (results, error) {
+	var reader, err = os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return parse(reader)
+}
+
+// parse reads benchmark results, qualifying their names with the package they belong to.
+func parse(reader io.Reader) (results, error) {
+	var parsed = make(results)
+	var pkg string
+
+	var scanner = bufio.NewScanner(reader)
+	for scanner.Scan() {
+		var fields = strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "pkg:" && len(fields) == 2 {
+			pkg = fields[1]
+			continue
+		}
+
+		if !strings.HasPrefix(fields[0], "Benchmark") || len(fields) < 4 || len(fields)%2 != 0 {
+			continue
+		}
+
+		var name = procsSuffix.ReplaceAllString(fields[0], "")
+		if len(pkg) > 0 {
+			name = pkg + "." + name
+		}
+
+		if parsed[name] == nil {
+			parsed[name] = make(map[string][]float64)
+		}
+
+		// fields[1] is the amount of iterations, which is followed by pairs of values and units
+		for i := 2; i < len(fields); i += 2 {
+			var value, err = strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid value '%s' of benchmark %s", fields[i], name))
+			}
+			parsed[name][fields[i+1]] = append(parsed[name][fields[i+1]], value)
+		}
+	}
+	return parsed, scanner.Err()
+}
+
+// compare prints the change of every benchmark and returns all changes above their threshold.
+func compare(baseline results, current results, thresholds map[string]float64, output io.Writer) []regression {
+	var regressions = make([]regression, 0)
+	for _, name := range sortedNames(current) {
+		var baselineMetrics, ok = baseline[name]
+		if !ok {
+			fmt.Fprintf(output, "%s: not in baseline\n", name)
+			continue
+		}
+
+		var changes = make([]string, 0, len(thresholds))
+		for _, metric := range []string{metricTime, metricBytes, metricAllocs} {
+			var baselineValues, currentValues = baselineMetrics[metric], current[name][metric]
+			if len(baselineValues) == 0 || len(currentValues) == 0 {
+				continue
+			}
+
+			var baselineMedian, currentMedian = median(baselineValues), median(currentValues)
+			changes = append(changes, fmt.Sprintf("%s %+.1f%%", metric, change(baselineMedian, currentMedian)))
+
+			var threshold = thresholds[metric]
+			if threshold >= 0 && change(baselineMedian, currentMedian) > threshold {
+				regressions = append(regressions, regression{name, metric, baselineMedian, currentMedian})
+			}
+		}
+		fmt.Fprintf(output, "%s: %s\n", name, strings.Join(changes, ", "))
+	}
+
+	for _, name := range sortedNames(baseline) {
+		if _, ok := current[name]; !ok {
+			fmt.Fprintf(output, "%s: not in current results\n", name)
+		}
+	}
+	return regressions
+}
+
+func sortedNames(results results) []string {
+	var names = make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// change returns the relative change from baseline to current in percent.
+func change(baseline float64, current float64) float64 {
+	if baseline == 0 {
+		if current == 0 {
+			return 0
+		}
+		return 100
+	}
+	return (current - baseline) / baseline * 100
+}
+
+func median(values []float64) float64 {
+	var sorted = slices.Clone(values)
+	slices.Sort(sorted)
+
+	var middle = len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 Deutsche Telekom IT GmbH
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const baselineOutput = `goos: linux
+pkg: vortex/service/utils
+BenchmarkFlatten_Deep-8   	     200	   5000000 ns/op	 2000000 B/op	   16000 allocs/op
+BenchmarkFlatten_Deep-8   	     200	   6000000 ns/op	 2000000 B/op	   16000 allocs/op
+BenchmarkFlatten_Deep-8   	     200	  10000000 ns/op	 2000000 B/op	   16000 allocs/op
+pkg: vortex/service/mongo
+BenchmarkBuildModels/coalesce=false-8   	    2814	    441856 ns/op	  228336 B/op	    3058 allocs/op
+BenchmarkRemoved-8   	    2814	    100 ns/op
+PASS
+`
+
+func TestParse(t *testing.T) {
+	var assertions = assert.New(t)
+
+	var parsed, err = parse(strings.NewReader(baselineOutput))
+	assertions.Nil(err, "expected no error")
+	assertions.Len(parsed, 3)
+	assertions.Equal([]float64{5000000, 6000000, 10000000}, parsed["vortex/service/utils.BenchmarkFlatten_Deep"][metricTime])
+	assertions.Equal([]float64{3058}, parsed["vortex/service/mongo.BenchmarkBuildModels/coalesce=false"][metricAllocs])
+}
+
+func TestCompare(t *testing.T) {
+	var assertions = assert.New(t)
+	var baseline, _ = parse(strings.NewReader(baselineOutput))
+	var current, _ = parse(strings.NewReader(`pkg: vortex/service/utils
+BenchmarkFlatten_Deep-4   	     200	   7500000 ns/op	 2000000 B/op	   16000 allocs/op
+pkg: vortex/service/mongo
+BenchmarkBuildModels/coalesce=false-4   	    2814	    441856 ns/op	  228336 B/op	    4000 allocs/op
+BenchmarkAdded-4   	    2814	    100 ns/op
+`))
+
+	var output bytes.Buffer
+	var thresholds = map[string]float64{metricTime: 20, metricBytes: 10, metricAllocs: 10}
+	var regressions = compare(baseline, current, thresholds, &output)
+
+	assertions.Len(regressions, 2)
+	assertions.Equal("vortex/service/mongo.BenchmarkBuildModels/coalesce=false", regressions[0].name)
+	assertions.Equal(metricAllocs, regressions[0].metric)
+	assertions.Equal("vortex/service/utils.BenchmarkFlatten_Deep", regressions[1].name)
+	assertions.Equal(metricTime, regressions[1].metric, "expected the median of the baseline to be compared")
+
+	assertions.Contains(output.String(), "vortex/service/mongo.BenchmarkAdded: not in baseline")
+	assertions.Contains(output.String(), "vortex/service/mongo.BenchmarkRemoved: not in current results")
+}
+
+func TestCompare_DisabledThreshold(t *testing.T) {
+	var assertions = assert.New(t)
+	var baseline, _ = parse(strings.NewReader("BenchmarkA-8 1 100 ns/op 10 allocs/op\n"))
+	var current, _ = parse(strings.NewReader("BenchmarkA-8 1 1000 ns/op 10 allocs/op\n"))
+
+	var regressions = compare(baseline, current, map[string]float64{metricTime: -1, metricAllocs: 10}, new(bytes.Buffer))
+	assertions.Empty(regressions, "expected time regressions to be ignored")
+}